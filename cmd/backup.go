@@ -0,0 +1,82 @@
+package cmd
+
+import (
+	"errors"
+	"os"
+
+	"github.com/spf13/cobra"
+	"transform/pkg/backup"
+	"transform/utils/log"
+)
+
+var backupOption backup.Options
+
+// backupCmd represents the kubelet snapshots taken before conversion
+var backupCmd = &cobra.Command{
+	Use:   "backup",
+	Short: "Inspect and restore the kubelet snapshots taken before conversion",
+	Long: `Each conversion saves the kubelet container, the old unit file and binary
+with a md5 manifest under the workspace. These snapshots can be listed, inspected and restored.`,
+	Example: `
+# List all snapshots
+transform backup list
+# Show a snapshot
+transform backup show 20240612101010
+# Restore a snapshot
+transform backup restore 20240612101010
+`,
+}
+
+var backupListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the kubelet snapshots",
+	Run: func(cmd *cobra.Command, args []string) {
+		backupOption.Options = options
+		backupOption.Args = args
+		runBackup(backupOption.List())
+	},
+}
+
+var backupShowCmd = &cobra.Command{
+	Use:   "show NAME",
+	Short: "Show the detail of a kubelet snapshot",
+	Args:  snapshotNameArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		backupOption.Options = options
+		backupOption.Name = args[0]
+		runBackup(backupOption.Show())
+	},
+}
+
+var backupRestoreCmd = &cobra.Command{
+	Use:   "restore NAME",
+	Short: "Restore the container-type kubelet from a snapshot",
+	Args:  snapshotNameArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		backupOption.Options = options
+		backupOption.Name = args[0]
+		runBackup(backupOption.Restore())
+	},
+}
+
+func snapshotNameArgs(cmd *cobra.Command, args []string) error {
+	if len(args) != 1 {
+		log.Error("The snapshot name is required. ")
+		return errors.New("The snapshot name is required. ")
+	}
+	return nil
+}
+
+func runBackup(err error) {
+	if err != nil {
+		log.BKEFormat(log.ERROR, err.Error())
+		os.Exit(1)
+	}
+}
+
+func init() {
+	rootCmd.AddCommand(backupCmd)
+	backupCmd.AddCommand(backupListCmd)
+	backupCmd.AddCommand(backupShowCmd)
+	backupCmd.AddCommand(backupRestoreCmd)
+}
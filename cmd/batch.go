@@ -4,6 +4,7 @@ import (
 	"errors"
 	"github.com/spf13/cobra"
 	"transform/pkg/batch"
+	"transform/pkg/remote"
 	"transform/utils/log"
 )
 
@@ -12,16 +13,44 @@ var batchOption batch.Options
 var batchCmd = &cobra.Command{
 	Use:   "batch",
 	Short: "批量执行kubelet任务转换",
-	Long:  `批量执行kubelet任务转换.`,
+	Long: `批量执行kubelet任务转换.
+
+使用--cordon或--drain时，kubeconfig会分发到各节点的/tmp/precheck/kubeconfig，节点上的转换结束后删除。
+建议通过--node-kubeconfig指定只有以下权限的kubeconfig，而不是集群管理员的kubeconfig:
+  nodes          get, list, patch
+  pods           list, get      (--drain)
+  pods/eviction  create         (--drain)`,
 	Example: `
 # 启动服务器资源检查
 transform batch --file nodes.yaml
+# 生成各节点的转换计划，不修改节点
+transform batch --file nodes.yaml --plan
+# 先转换worker节点，每次最多转换2个节点，失败1个节点后停止
+transform batch --file nodes.yaml --order workers-first --max-parallel 2 --max-failures 0
+# 转换前驱逐节点上的pod，节点Ready后解除封锁
+transform batch --file nodes.yaml --drain --kubeconfig /root/.kube/config
+# 各节点使用权限受限的kubeconfig封锁和驱逐节点
+transform batch --file nodes.yaml --drain --node-kubeconfig /root/transform-drain.kubeconfig
+# 首次连接时记录各节点的主机公钥，之后按记录的公钥校验
+transform batch --file nodes.yaml --host-key-check tofu
+# 各节点直接使用kubelet容器中的kubelet，不需要下载
+transform batch --file nodes.yaml --from-image
+# 从中断处继续上一次的批量转换，沿用上一次的参数
+transform batch --file nodes.yaml --resume
 `,
 	Args: func(cmd *cobra.Command, args []string) error {
 		if batchOption.File == "" {
 			log.Error("The `file` parameter is required. ")
 			return errors.New("The `file` parameter is required. ")
 		}
+		switch batchOption.HostKeyCheck {
+		case remote.HostKeyStrict, remote.HostKeyTOFU, remote.HostKeyInsecure:
+		default:
+			return errors.New("The `host-key-check` parameter must be one of strict, tofu, insecure. ")
+		}
+		if (batchOption.Cordon || batchOption.Drain) && options.KubeConfig == "" && batchOption.NodeKubeConfig == "" {
+			return errors.New("The `node-kubeconfig` or `kubeconfig` parameter is required to cordon or drain nodes. ")
+		}
 		return nil
 	},
 	Run: func(cmd *cobra.Command, args []string) {
@@ -35,7 +64,29 @@ func init() {
 	rootCmd.AddCommand(batchCmd)
 
 	batchCmd.PersistentFlags().StringVarP(&batchOption.File, "file", "f", "", "服务器配置列表")
-	batchCmd.Flags().StringVarP(&kubeletOption.HttpRepo, "http-repo", "p", "http://deploy.bocloud.k8s:40080/files/", "Kubelet file storage address. example http://deploy.bocloud.k8s:40080/files/ ")
-	batchCmd.Flags().StringVarP(&kubeletOption.KubeVersion, "kubernetes-version", "v", "", "The version of kubernetes. For example, 1.21.13/1.26.15")
-	batchCmd.Flags().StringVarP(&kubeletOption.Runtime, "runtime", "r", "", "The type of runtime. For example, docker/containerd")
+	batchCmd.Flags().StringVarP(&batchOption.HttpRepo, "http-repo", "p", "http://deploy.bocloud.k8s:40080/files/", "Kubelet file storage address. example http://deploy.bocloud.k8s:40080/files/ ")
+	batchCmd.Flags().StringVar(&batchOption.ArtifactSource, "artifact-source", "", "kubelet二进制文件的来源，<类型>[=<地址>]: http、release、local=<节点上的路径>或image，默认从--http-repo下载")
+	batchCmd.Flags().BoolVar(&batchOption.FromImage, "from-image", false, "各节点从正在运行的kubelet容器中复制kubelet，保证版本与转换前一致，不需要指定--kubernetes-version")
+	batchCmd.Flags().StringVarP(&batchOption.KubeVersion, "kubernetes-version", "v", "", "The version of kubernetes. For example, 1.21.13/1.26.15, detected from the kubelet container on each node by default")
+	batchCmd.Flags().StringVarP(&batchOption.Runtime, "runtime", "r", "", "The type of runtime. For example, docker/containerd, detected on each node by default")
+	batchCmd.Flags().BoolVar(&batchOption.Plan, "plan", false, "只生成各节点的转换计划并汇总到报告中，不修改节点")
+	batchCmd.Flags().IntVar(&batchOption.MaxParallel, "max-parallel", 0, "同时转换的最大节点数，0表示不限制")
+	batchCmd.Flags().IntVar(&batchOption.MaxFailures, "max-failures", 0, "允许失败的节点数，超过后停止转换剩余节点")
+	batchCmd.Flags().StringVar(&batchOption.Order, "order", "", "转换顺序: workers-first先转换worker节点再转换控制平面节点，group按节点的group分批转换，默认按配置文件中的顺序")
+	batchCmd.Flags().BoolVar(&batchOption.Cordon, "cordon", false, "转换前封锁节点，节点Ready后解除封锁，需要指定--kubeconfig")
+	batchCmd.Flags().BoolVar(&batchOption.Drain, "drain", false, "转换前封锁节点并驱逐pod，遵守PodDisruptionBudget，需要指定--kubeconfig")
+	batchCmd.Flags().Int64Var(&batchOption.DrainTimeout, "drain-timeout", 5, "驱逐节点上pod的超时时间，单位分钟")
+	batchCmd.Flags().StringVar(&batchOption.NodeKubeConfig, "node-kubeconfig", "", "分发到各节点用于封锁和驱逐节点的kubeconfig，只需要nodes的get、list、patch，pods的get、list和pods/eviction的create权限，默认使用--kubeconfig")
+	batchCmd.Flags().BoolVar(&batchOption.DrainForce, "drain-force", false, "驱逐时同时删除不受控制器管理的pod，这些pod不会被重新创建，默认有这类pod时拒绝驱逐")
+	batchCmd.Flags().StringVar(&batchOption.HostKeyCheck, "host-key-check", remote.HostKeyStrict, "主机公钥校验方式: strict只信任known_hosts中的主机，tofu首次连接时记录新主机的公钥，insecure不校验")
+	batchCmd.Flags().StringVar(&batchOption.KnownHosts, "known-hosts", "", "额外的known_hosts文件，默认读取~/.ssh/known_hosts和工作目录中的known_hosts")
+	batchCmd.Flags().BoolVar(&batchOption.Resume, "resume", false, "从batch-state.yaml中记录的阶段继续上一次中断的转换，上一次失败的节点重新转换")
+	batchCmd.Flags().IntVar(&batchOption.Fanout, "fanout", 0, "每种架构先上传到的种子节点数，其余节点从种子节点下载二进制文件，0表示全部由主控节点上传")
+	batchCmd.Flags().IntVar(&batchOption.FanoutPort, "fanout-port", 40081, "种子节点上提供下载服务的端口")
+	batchCmd.Flags().StringVar(&batchOption.ServeDir, "serve-dir", "", "在主控节点上提供该目录中kubelet和transform二进制文件的下载，各节点的--http-repo自动指向它")
+	batchCmd.Flags().IntVar(&batchOption.ServePort, "serve-port", 40080, "主控节点上文件下载服务的端口")
+	batchCmd.Flags().StringVar(&batchOption.ServeAddress, "serve-address", "", "节点访问主控节点使用的地址，默认使用连接节点的本地地址，经过跳板机时需要指定")
+	batchCmd.Flags().StringVar(&batchOption.PublicKey, "public-key", "", "校验--http-repo中SHA256SUMS签名的minisign公钥，可以是主控节点上的公钥文件或base64编码的公钥")
+	batchCmd.Flags().BoolVar(&batchOption.InsecureSkipVerify, "insecure-skip-verify", false, "不校验各节点获取的kubelet，仅用于没有SHA256SUMS的仓库或本地文件")
+	batchCmd.Flags().Int64VarP(&batchOption.Timeout, "timeout", "t", 2, "timout of each node. default is 2 minute")
 }
\ No newline at end of file
@@ -1,8 +1,12 @@
 package cmd
 
 import (
+	"os"
+	"time"
+
 	"github.com/spf13/cobra"
 	"transform/pkg/kubelet"
+	"transform/utils/log"
 )
 
 var kubeletOption = kubelet.Options{}
@@ -14,24 +18,88 @@ var kubeletCmd = &cobra.Command{
 	Long:  `The container type kubelet is automatically converted to the binary type kubelet.
 Contains containers of docker and containerd types`,
 	Example: `
-# Resetting the boot node
+# Resetting the boot node, the runtime and version are detected from the kubelet container
+transform kubelet
 transform kubelet -v 1.21.13 -r docker
 transform kubelet -v 1.21.13 -r containerd
 transform kubelet -v 1.26.15 -r containerd
+# Show the changes without touching the node
+transform kubelet -v 1.21.13 -r docker --dry-run
+# Download the kubelet from dl.k8s.io or copy it from the kubelet image
+transform kubelet -v 1.26.15 -r containerd --artifact-source release
+transform kubelet -v 1.21.13 -r docker --artifact-source image
+# Reuse the exact kubelet binary of the running container
+transform kubelet -r containerd --from-image
+# Drain the node before the conversion and uncordon it once it is Ready
+transform kubelet -v 1.21.13 -r docker --drain --kubeconfig /root/.kube/config
 `,
 	Run: func(cmd *cobra.Command, args []string) {
 		kubeletOption.Options = options
 		kubeletOption.Args = args
-		kubeletOption.Reset()
+		startTime := time.Now()
+		if kubeletOption.DryRun {
+			plan, err := kubeletOption.Plan()
+			kubeletOption.WritePlan(startTime, plan, err)
+			if err != nil {
+				log.BKEFormat(log.ERROR, err.Error())
+				os.Exit(1)
+			}
+			plan.Print()
+			return
+		}
+		err := kubeletOption.Reset()
+		kubeletOption.WriteResult(startTime, err)
+		if err != nil {
+			log.BKEFormat(log.ERROR, err.Error())
+			os.Exit(1)
+		}
+	},
+}
+
+// rollbackCmd restore the containerized kubelet from a snapshot
+var rollbackCmd = &cobra.Command{
+	Use:   "rollback",
+	Short: "Restore the container-type kubelet from a snapshot, the latest one by default",
+	Long:  `Stop the binary kubelet, restore the original unit file and binary,
+and recreate the kubelet container exactly as it was before the conversion`,
+	Example: `
+# Rollback a failed conversion
+transform kubelet rollback
+# Rollback to the snapshot taken by a given conversion
+transform kubelet rollback --snapshot 20240601103000.123456789
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		kubeletOption.Options = options
+		if err := kubeletOption.Rollback(); err != nil {
+			log.BKEFormat(log.ERROR, err.Error())
+			os.Exit(1)
+		}
 	},
 }
 
 func init() {
 	rootCmd.AddCommand(kubeletCmd)
+	kubeletCmd.AddCommand(rollbackCmd)
+	rollbackCmd.Flags().StringVar(&kubeletOption.Snapshot, "snapshot", "", "Name of the snapshot to restore, see 'transform backup list'")
 
 	// Here you will define your flags and configuration settings.
 	kubeletCmd.Flags().StringVarP(&kubeletOption.HttpRepo, "http-repo", "p", "http://deploy.bocloud.k8s:40080/files/", "Kubelet file storage address. example http://deploy.bocloud.k8s:40080/files/ ")
-	kubeletCmd.Flags().StringVarP(&kubeletOption.KubeVersion, "kubernetes-version", "v", "", "The version of kubernetes. For example, 1.21.13/1.26.15")
-	kubeletCmd.Flags().StringVarP(&kubeletOption.Runtime, "runtime", "r", "", "The type of runtime. For example, docker/containerd")
+	kubeletCmd.Flags().StringVar(&kubeletOption.ArtifactSource, "artifact-source", "", `Where to get the kubelet binary, <type>[=<location>]:
+  http[=<url>]      kubelet-<version>-<arch> in the http repo, --http-repo by default
+  release[=<url>]   release/v<version>/bin/linux/<arch>/kubelet layout, https://dl.k8s.io/release/ by default
+  local=<path>      kubelet binary, kubernetes-node-linux-<arch>.tar.gz or a directory containing them on the node
+  image             the image of the running kubelet container`)
+	kubeletCmd.Flags().BoolVar(&kubeletOption.FromImage, "from-image", false, "Copy the kubelet binary out of the running kubelet container, neither --http-repo nor --kubernetes-version is needed")
+	kubeletCmd.Flags().StringVarP(&kubeletOption.KubeVersion, "kubernetes-version", "v", "", "The version of kubernetes. For example, 1.21.13/1.26.15, detected from the kubelet container by default")
+	kubeletCmd.Flags().StringVarP(&kubeletOption.Runtime, "runtime", "r", "", "The type of runtime. For example, docker/containerd, detected by where the kubelet container runs by default")
 	kubeletCmd.Flags().Int64VarP(&kubeletOption.Timeout, "timeout", "t", 2, "timout. default is 2 minute")
+	kubeletCmd.Flags().BoolVar(&kubeletOption.DryRun, "dry-run", false, "Only print the unit file and the changes that would be made")
+	kubeletCmd.Flags().BoolVar(&kubeletOption.Cordon, "cordon", false, "Cordon the node before the conversion and uncordon it once the node is Ready, requires --kubeconfig")
+	kubeletCmd.Flags().BoolVar(&kubeletOption.Drain, "drain", false, "Cordon the node and evict its pods respecting PodDisruptionBudgets, requires --kubeconfig")
+	kubeletCmd.Flags().Int64Var(&kubeletOption.DrainTimeout, "drain-timeout", 5, "timeout of draining the node in minutes")
+	kubeletCmd.Flags().BoolVar(&kubeletOption.DrainForce, "drain-force", false, "Also delete pods not managed by a controller when draining, they are not recreated anywhere")
+	kubeletCmd.Flags().StringVar(&kubeletOption.NodeName, "node-name", "", "Name of the node in kubernetes, detected by hostname and addresses by default")
+	kubeletCmd.Flags().StringVar(&kubeletOption.PublicKey, "public-key", "", "Minisign public key, file path or base64 string, to verify the signature of SHA256SUMS in the http repo")
+	kubeletCmd.Flags().BoolVar(&kubeletOption.InsecureSkipVerify, "insecure-skip-verify", false, "Do not verify the kubelet against SHA256SUMS, needed for an http repo or a local file without SHA256SUMS")
+	kubeletCmd.Flags().StringVar(&kubeletOption.ResultDir, "result-dir", "", "Directory to write result.yaml or error.log for the batch controller")
 }
\ No newline at end of file
@@ -0,0 +1,52 @@
+package cmd
+
+import (
+	"errors"
+	"os"
+
+	"github.com/spf13/cobra"
+	"transform/pkg/serve"
+	"transform/utils/log"
+)
+
+var serveOption serve.Options
+
+// serveCmd represents the file server used to distribute binaries between nodes
+var serveCmd = &cobra.Command{
+	Use:   "serve",
+	Short: "Serve the kubelet and transform binaries over http",
+	Long: `Serve the files in a directory over http, for example kubelet-<version>-<arch> and
+the transform binaries, so that the nodes can be converted without an external http repo.
+The index lists every file with its sha256, /SHA256SUMS can be checked with sha256sum -c,
+and range requests are supported to resume downloads.`,
+	Example: `
+# Serve the files in ./artifacts on port 40080, and use http://<ip>:40080/ as --http-repo
+transform serve --dir ./artifacts --port 40080
+`,
+	Args: func(cmd *cobra.Command, args []string) error {
+		if serveOption.Dir == "" {
+			log.Error("The `dir` parameter is required. ")
+			return errors.New("The `dir` parameter is required. ")
+		}
+		if serveOption.Port <= 0 || serveOption.Port > 65535 {
+			log.Error("The `port` parameter must be between 1 and 65535. ")
+			return errors.New("The `port` parameter must be between 1 and 65535. ")
+		}
+		return nil
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		serveOption.Args = args
+		serveOption.Options = options
+		if err := serveOption.Run(); err != nil {
+			log.BKEFormat(log.ERROR, err.Error())
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(serveCmd)
+
+	serveCmd.Flags().StringVar(&serveOption.Dir, "dir", "", "The directory to serve")
+	serveCmd.Flags().IntVar(&serveOption.Port, "port", 40080, "The port to listen on")
+}
@@ -0,0 +1,421 @@
+package backup
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+	"transform/pkg/executor/containerd"
+	"transform/pkg/global"
+	"transform/pkg/infrastructure"
+	"transform/utils"
+	"transform/utils/log"
+
+	"github.com/containerd/containerd/errdefs"
+	"github.com/docker/docker/api/types"
+)
+
+const (
+	snapshotFile  = "snapshot.json"
+	containerFile = "container.json"
+	mountsFile    = "mounts.json"
+	envFile       = "env"
+	imageFile     = "image"
+	unitFile      = "kubelet.service"
+	binaryFile    = "kubelet"
+	manifestFile  = "manifest.json"
+)
+
+// Snapshot 转换前kubelet的原始状态，包括容器的完整配置、原有的unit文件和二进制文件
+type Snapshot struct {
+	Name        string                    `json:"name"`
+	CreatedAt   time.Time                 `json:"createdAt"`
+	Runtime     string                    `json:"runtime"`
+	Container   string                    `json:"container"`
+	Docker      *types.ContainerJSON      `json:"docker,omitempty"`
+	Containerd  *containerd.ContainerInfo `json:"containerd,omitempty"`
+	HasUnit     bool                      `json:"hasUnit"`
+	UnitEnabled bool                      `json:"unitEnabled"`
+	HasBinary   bool                      `json:"hasBinary"`
+}
+
+// Mount 容器的挂载信息
+type Mount struct {
+	Type        string `json:"type"`
+	Source      string `json:"source"`
+	Destination string `json:"destination"`
+	RW          bool   `json:"rw"`
+}
+
+// Manifest 备份目录中各文件的md5值
+type Manifest map[string]string
+
+// nameFormat 备份名称，精确到纳秒，同一秒内的多次转换不会使用同一个目录
+const nameFormat = "20060102150405.000000000"
+
+// validName 备份名称只能包含字母、数字和._-，且不能以.开头，避免拼接路径后访问备份目录之外的文件
+var validName = regexp.MustCompile(`^[0-9A-Za-z][0-9A-Za-z._-]*$`)
+
+// ValidName 是否是合法的备份名称
+func ValidName(name string) bool {
+	return validName.MatchString(name)
+}
+
+// Dir 备份的根目录
+func Dir() string {
+	return path.Join(global.Workspace, "backup")
+}
+
+func (s *Snapshot) path() string {
+	return path.Join(Dir(), s.Name)
+}
+
+// Take 在修改节点前记录kubelet容器及相关文件，并保存到工作目录
+func Take(runtime, containerName string) (*Snapshot, error) {
+	s, err := Inspect(runtime, containerName)
+	if err != nil {
+		return nil, err
+	}
+	if err = os.MkdirAll(Dir(), 0755); err != nil {
+		return nil, err
+	}
+	// 目录已经存在时失败，不覆盖其他转换的备份
+	if err = os.Mkdir(s.path(), 0755); err != nil {
+		return nil, err
+	}
+	if utils.Exists(utils.KubeletServiceFile) {
+		if err = utils.CopyFile(utils.KubeletServiceFile, path.Join(s.path(), unitFile)); err != nil {
+			return nil, err
+		}
+		s.HasUnit = true
+		state, _ := global.Command.ExecuteCommandWithOutput("systemctl", "is-enabled", "kubelet")
+		s.UnitEnabled = strings.TrimSpace(state) == "enabled"
+	}
+	if utils.Exists(utils.KubeletBinary) {
+		if err = utils.CopyFile(utils.KubeletBinary, path.Join(s.path(), binaryFile)); err != nil {
+			return nil, err
+		}
+		s.HasBinary = true
+	}
+
+	if err = s.save(); err != nil {
+		return nil, err
+	}
+	log.Infof("snapshot of kubelet saved to %s", s.path())
+	return s, nil
+}
+
+// Inspect 只读取kubelet容器的信息，不写入任何文件
+func Inspect(runtime, containerName string) (*Snapshot, error) {
+	now := time.Now()
+	s := &Snapshot{
+		Name:      now.Format(nameFormat),
+		CreatedAt: now,
+		Runtime:   runtime,
+		Container: containerName,
+	}
+
+	switch runtime {
+	case "docker":
+		info, ok := global.Docker.ContainerExists(containerName)
+		if !ok {
+			return nil, fmt.Errorf("container %s not found", containerName)
+		}
+		s.Docker = &info
+	case "containerd":
+		if err := containerdClient(); err != nil {
+			return nil, err
+		}
+		info, err := global.Containerd.ContainerFind(containerName)
+		if err != nil {
+			return nil, err
+		}
+		s.Containerd = &info
+	default:
+		return nil, fmt.Errorf("unsupported runtime %q", runtime)
+	}
+	return s, nil
+}
+
+// save 写入快照及容器的原始信息，最后生成md5清单
+func (s *Snapshot) save() error {
+	var container interface{} = s.Docker
+	if s.Containerd != nil {
+		container = s.Containerd
+	}
+	mounts, err := json.MarshalIndent(s.Mounts(), "", "  ")
+	if err != nil {
+		return err
+	}
+	if err = writeJSON(path.Join(s.path(), containerFile), container); err != nil {
+		return err
+	}
+	if err = os.WriteFile(path.Join(s.path(), mountsFile), mounts, 0644); err != nil {
+		return err
+	}
+	if err = os.WriteFile(path.Join(s.path(), envFile), []byte(strings.Join(s.Env(), "\n")), 0644); err != nil {
+		return err
+	}
+	if err = os.WriteFile(path.Join(s.path(), imageFile), []byte(s.Image()), 0644); err != nil {
+		return err
+	}
+	if err = writeJSON(path.Join(s.path(), snapshotFile), s); err != nil {
+		return err
+	}
+
+	manifest := Manifest{}
+	entries, err := os.ReadDir(s.path())
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if e.IsDir() || e.Name() == manifestFile {
+			continue
+		}
+		sum, err := utils.Md5string(path.Join(s.path(), e.Name()))
+		if err != nil {
+			return err
+		}
+		manifest[e.Name()] = sum
+	}
+	return writeJSON(path.Join(s.path(), manifestFile), manifest)
+}
+
+func writeJSON(file string, v interface{}) error {
+	b, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(file, b, 0644)
+}
+
+// Manifest 读取备份的md5清单
+func (s *Snapshot) Manifest() (Manifest, error) {
+	b, err := os.ReadFile(path.Join(s.path(), manifestFile))
+	if err != nil {
+		return nil, err
+	}
+	manifest := Manifest{}
+	if err = json.Unmarshal(b, &manifest); err != nil {
+		return nil, err
+	}
+	return manifest, nil
+}
+
+// Verify 按md5清单校验备份文件是否完整
+func (s *Snapshot) Verify() error {
+	manifest, err := s.Manifest()
+	if err != nil {
+		return err
+	}
+	for name, sum := range manifest {
+		actual, err := utils.Md5string(path.Join(s.path(), name))
+		if err != nil {
+			return fmt.Errorf("snapshot %s: %v", s.Name, err)
+		}
+		if actual != sum {
+			return fmt.Errorf("snapshot %s: md5 of %s does not match the manifest", s.Name, name)
+		}
+	}
+	return nil
+}
+
+// Image 容器使用的镜像
+func (s *Snapshot) Image() string {
+	if s.Docker != nil && s.Docker.Config != nil {
+		return s.Docker.Config.Image
+	}
+	if s.Containerd != nil {
+		return s.Containerd.Image
+	}
+	return ""
+}
+
+// Env 容器的环境变量
+func (s *Snapshot) Env() []string {
+	if s.Docker != nil && s.Docker.Config != nil {
+		return s.Docker.Config.Env
+	}
+	if s.Containerd != nil && s.Containerd.Spec != nil {
+		return s.Containerd.Env()
+	}
+	return nil
+}
+
+// Mounts 容器的挂载信息
+func (s *Snapshot) Mounts() []Mount {
+	mounts := []Mount{}
+	if s.Docker != nil {
+		for _, m := range s.Docker.Mounts {
+			mounts = append(mounts, Mount{Type: string(m.Type), Source: m.Source, Destination: m.Destination, RW: m.RW})
+		}
+	}
+	if s.Containerd != nil && s.Containerd.Spec != nil {
+		for _, m := range s.Containerd.Mounts() {
+			mounts = append(mounts, Mount{Type: m.Type, Source: m.Source, Destination: m.Destination, RW: m.RW})
+		}
+	}
+	return mounts
+}
+
+// Args kubelet容器的启动参数
+func (s *Snapshot) Args() []string {
+	if s.Docker != nil {
+		return s.Docker.Args
+	}
+	if s.Containerd != nil && s.Containerd.Spec != nil {
+		return s.Containerd.Args()
+	}
+	return nil
+}
+
+// List 按创建时间排序的所有备份名称
+func List() ([]string, error) {
+	entries, err := os.ReadDir(Dir())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	names := []string{}
+	for _, e := range entries {
+		if e.IsDir() && utils.Exists(path.Join(Dir(), e.Name(), snapshotFile)) {
+			names = append(names, e.Name())
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// Load 读取指定名称的备份
+func Load(name string) (*Snapshot, error) {
+	if !ValidName(name) {
+		return nil, fmt.Errorf("invalid snapshot name %q", name)
+	}
+	b, err := os.ReadFile(path.Join(Dir(), name, snapshotFile))
+	if err != nil {
+		return nil, err
+	}
+	s := &Snapshot{}
+	if err = json.Unmarshal(b, s); err != nil {
+		return nil, err
+	}
+	s.Name = name
+	return s, nil
+}
+
+// Latest 读取最近一次的备份
+func Latest() (*Snapshot, error) {
+	names, err := List()
+	if err != nil {
+		return nil, err
+	}
+	if len(names) == 0 {
+		return nil, errors.New("no kubelet snapshot found in " + Dir())
+	}
+	return Load(names[len(names)-1])
+}
+
+// Restore 停止二进制kubelet，还原unit文件和二进制文件，并按原配置重新创建kubelet容器
+func (s *Snapshot) Restore() error {
+	if err := s.Verify(); err != nil {
+		return err
+	}
+	log.Infof("restore kubelet from snapshot %s", s.path())
+	_ = global.Command.ExecuteCommand("systemctl", "disable", "kubelet", "--now")
+
+	if err := restoreFile(s.HasUnit, path.Join(s.path(), unitFile), utils.KubeletServiceFile, 0644); err != nil {
+		return err
+	}
+	if err := restoreFile(s.HasBinary, path.Join(s.path(), binaryFile), utils.KubeletBinary, 0755); err != nil {
+		return err
+	}
+	if err := global.Command.ExecuteCommand("systemctl", "daemon-reload"); err != nil {
+		log.Error(err)
+	}
+	if s.UnitEnabled {
+		if err := global.Command.ExecuteCommand("systemctl", "enable", "kubelet"); err != nil {
+			log.Error(err)
+		}
+	}
+
+	switch s.Runtime {
+	case "docker":
+		return s.restoreDocker()
+	case "containerd":
+		return s.restoreContainerd()
+	}
+	return fmt.Errorf("unsupported runtime %q", s.Runtime)
+}
+
+func (s *Snapshot) restoreDocker() error {
+	if s.Docker == nil {
+		return errors.New("snapshot does not contain docker container info")
+	}
+	if !infrastructure.IsDocker() {
+		return errors.New("docker is not running")
+	}
+	id := s.Container
+	if _, ok := global.Docker.ContainerExists(s.Container); !ok {
+		var err error
+		id, err = global.Docker.ContainerCreate(*s.Docker)
+		if err != nil {
+			return err
+		}
+		log.Infof("container %s recreated", s.Container)
+	}
+	return global.Docker.ContainerStart(id)
+}
+
+func (s *Snapshot) restoreContainerd() error {
+	if s.Containerd == nil {
+		return errors.New("snapshot does not contain containerd container info")
+	}
+	if err := containerdClient(); err != nil {
+		return err
+	}
+	if _, err := global.Containerd.ContainerInspect(s.Containerd.ID); err != nil {
+		if !errdefs.IsNotFound(err) {
+			return err
+		}
+		if err = global.Containerd.ContainerCreate(*s.Containerd); err != nil {
+			return err
+		}
+		log.Infof("container %s recreated", s.Container)
+	}
+	err := global.Containerd.ContainerStart(s.Containerd.ID)
+	if err != nil && !errdefs.IsAlreadyExists(err) {
+		return err
+	}
+	return nil
+}
+
+// containerdClient 按需连接containerd
+func containerdClient() error {
+	if global.Containerd != nil {
+		return nil
+	}
+	var err error
+	global.Containerd, err = containerd.NewContainedClient()
+	return err
+}
+
+// restoreFile 备份中存在则拷贝回原位置，否则删除转换时新建的文件
+func restoreFile(exists bool, src, dst string, perm os.FileMode) error {
+	if !exists {
+		if err := os.Remove(dst); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	if err := utils.CopyFile(src, dst); err != nil {
+		return err
+	}
+	return os.Chmod(dst, perm)
+}
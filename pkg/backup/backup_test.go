@@ -0,0 +1,50 @@
+package backup
+
+import (
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+	"transform/pkg/global"
+)
+
+// TestLoad 验证按名称读取备份，拒绝访问备份目录之外的名称
+func TestLoad(t *testing.T) {
+	defer func(workspace string) { global.Workspace = workspace }(global.Workspace)
+	global.Workspace = t.TempDir()
+
+	s := &Snapshot{Name: time.Now().Format(nameFormat), Runtime: "docker"}
+	if err := os.MkdirAll(s.path(), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeJSON(path.Join(s.path(), snapshotFile), s); err != nil {
+		t.Fatal(err)
+	}
+	// 备份目录之外的snapshot.json
+	if err := writeJSON(path.Join(global.Workspace, snapshotFile), s); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := Load(s.Name)
+	if err != nil || loaded.Runtime != "docker" {
+		t.Fatalf("Load(%s) = %+v, %v", s.Name, loaded, err)
+	}
+	for _, name := range []string{"", ".", "..", "../backup/" + s.Name, "/etc", "a b"} {
+		if _, err := Load(name); err == nil || !strings.Contains(err.Error(), "invalid snapshot name") {
+			t.Errorf("Load(%q) = %v, want invalid snapshot name", name, err)
+		}
+	}
+}
+
+// TestNameFormat 验证同一秒内生成的备份名称不同，且按时间排序
+func TestNameFormat(t *testing.T) {
+	now := time.Date(2024, 6, 1, 10, 30, 0, 0, time.Local)
+	first, second := now.Add(time.Millisecond).Format(nameFormat), now.Add(2*time.Millisecond).Format(nameFormat)
+	if first == second || first > second {
+		t.Errorf("names %s and %s are not unique and ordered", first, second)
+	}
+	if !ValidName(first) {
+		t.Errorf("generated name %s is not valid", first)
+	}
+}
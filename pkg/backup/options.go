@@ -0,0 +1,116 @@
+package backup
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"transform/pkg/root"
+	"transform/utils/log"
+)
+
+type Options struct {
+	root.Options
+	Name string `json:"name"`
+}
+
+// List 输出所有备份
+func (op *Options) List() error {
+	names, err := List()
+	if err != nil {
+		return err
+	}
+	if len(names) == 0 {
+		log.BKEFormat(log.NIL, fmt.Sprintf("no snapshot found in %s", Dir()))
+		return nil
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tCREATED\tRUNTIME\tIMAGE\tVERIFIED")
+	for _, name := range names {
+		s, err := Load(name)
+		if err != nil {
+			fmt.Fprintf(w, "%s\t-\t-\t-\t%v\n", name, err)
+			continue
+		}
+		verified := "ok"
+		if err = s.Verify(); err != nil {
+			verified = "corrupted"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", name, s.CreatedAt.Format("2006-01-02 15:04:05"), s.Runtime, s.Image(), verified)
+	}
+	return w.Flush()
+}
+
+// Show 输出备份的详细内容
+func (op *Options) Show() error {
+	s, err := op.load()
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Name:      %s\n", s.Name)
+	fmt.Printf("Path:      %s\n", s.path())
+	fmt.Printf("Created:   %s\n", s.CreatedAt.Format("2006-01-02 15:04:05"))
+	fmt.Printf("Runtime:   %s\n", s.Runtime)
+	fmt.Printf("Container: %s\n", s.Container)
+	fmt.Printf("Image:     %s\n", s.Image())
+	fmt.Printf("Args:\n")
+	for _, arg := range s.Args() {
+		fmt.Printf("  %s\n", arg)
+	}
+	fmt.Printf("Env:\n")
+	for _, env := range s.Env() {
+		fmt.Printf("  %s\n", env)
+	}
+	fmt.Printf("Mounts:\n")
+	for _, m := range s.Mounts() {
+		mode := "ro"
+		if m.RW {
+			mode = "rw"
+		}
+		fmt.Printf("  %s -> %s (%s)\n", m.Source, m.Destination, mode)
+	}
+	fmt.Printf("Unit file: %t (enabled: %t)\n", s.HasUnit, s.UnitEnabled)
+	fmt.Printf("Binary:    %t\n", s.HasBinary)
+
+	manifest, err := s.Manifest()
+	if err != nil {
+		return err
+	}
+	files := make([]string, 0, len(manifest))
+	for name := range manifest {
+		files = append(files, name)
+	}
+	sort.Strings(files)
+	fmt.Printf("Manifest:\n")
+	for _, name := range files {
+		fmt.Printf("  %s  %s\n", manifest[name], name)
+	}
+	if err = s.Verify(); err != nil {
+		fmt.Printf("Verify:    %v\n", err)
+	} else {
+		fmt.Printf("Verify:    ok\n")
+	}
+	return nil
+}
+
+// Restore 使用指定的备份恢复容器化的kubelet
+func (op *Options) Restore() error {
+	s, err := op.load()
+	if err != nil {
+		return err
+	}
+	if err = s.Restore(); err != nil {
+		return err
+	}
+	log.BKEFormat(log.INFO, fmt.Sprintf("kubelet restored from snapshot %s", s.Name))
+	return nil
+}
+
+func (op *Options) load() (*Snapshot, error) {
+	if strings.TrimSpace(op.Name) == "" {
+		return nil, errors.New("the snapshot name is required")
+	}
+	return Load(op.Name)
+}
@@ -5,9 +5,12 @@ import (
 	"fmt"
 	"os"
 	"path"
+	"strconv"
 	"strings"
 	"time"
+	"transform/pkg/backup"
 	"transform/pkg/configuration"
+	"transform/pkg/global"
 	"transform/pkg/remote"
 	"transform/pkg/report"
 	"transform/pkg/root"
@@ -23,13 +26,50 @@ type Options struct {
 	root.Options
 	File string `yaml:"file" json:"file"`
 	HttpRepo string `json:"httpRepo"`
+	// kubelet二进制文件的来源，原样传给各节点的transform kubelet
+	ArtifactSource string `json:"artifactSource"`
+	// 各节点从正在运行的kubelet容器中复制kubelet，不需要指定版本
+	FromImage bool `json:"fromImage"`
 	KubeVersion string `json:"kubeVersion"`
 	Runtime string `json:"runtime"`
+	Timeout int64 `json:"timeout"`
+	Plan bool `json:"plan"`
+	// 同时转换的最大节点数，0表示不限制
+	MaxParallel int `json:"maxParallel"`
+	// 允许失败的节点数，超过后停止滚动转换
+	MaxFailures int `json:"maxFailures"`
+	// 转换顺序，workers-first或group，默认按配置文件中的顺序
+	Order string `json:"order"`
+	// 转换前封锁或驱逐节点，需要通过--kubeconfig指定有权限的kubeconfig，会分发到各个节点
+	Cordon bool `json:"cordon"`
+	Drain bool `json:"drain"`
+	DrainTimeout int64 `json:"drainTimeout"`
+	DrainForce bool `json:"drainForce"`
+	// 分发到各节点的kubeconfig，只需要封锁和驱逐节点的权限，默认使用--kubeconfig
+	NodeKubeConfig string `json:"nodeKubeConfig"`
+	// 主机公钥的校验方式，strict、tofu或insecure
+	HostKeyCheck string `json:"hostKeyCheck"`
+	// 额外的known_hosts文件
+	KnownHosts string `json:"knownHosts"`
+	// 从状态文件中记录的阶段继续上一次中断的转换
+	Resume bool `json:"resume"`
+	// 每种架构上传到的种子节点数，其余节点从种子节点下载，0表示全部由主控节点上传
+	Fanout     int `json:"fanout"`
+	FanoutPort int `json:"fanoutPort"`
+	// 在主控节点上提供该目录中文件的下载，各节点的--http-repo自动指向它
+	ServeDir  string `json:"serveDir"`
+	ServePort int    `json:"servePort"`
+	// 节点访问主控节点使用的地址，默认自动获取
+	ServeAddress string `json:"serveAddress"`
+	// 校验SHA256SUMS签名的minisign公钥文件或base64编码的公钥，以base64编码传给各节点
+	PublicKey string `json:"publicKey"`
+	// 不校验下载的kubelet
+	InsecureSkipVerify bool `json:"insecureSkipVerify"`
 }
 
 type nodeTask struct {
 	ip   string
-	cli  *remote.Cli
+	host configuration.Host
 }
 
 var (
@@ -38,79 +78,141 @@ var (
 	resultFile    = "result.yaml"
 	httppid       = "httppid"
 	checkpid      = "checkpid"
+	// 节点上的转换记录的备份名称和已修改节点的标记
+	snapshotNameFile = "snapshot"
+	modifiedFile     = "modified"
+	kubeconfigFile = "kubeconfig"
+	// 一次转换在节点上留下的结果文件和日志
+	resultFiles = []string{errorFile, resultFile, snapshotNameFile, modifiedFile, "transform.log", "rollback.log"}
 	nodeTaskMap   = make(map[string]nodeTask)
-	nodeResultMap = make(map[string]uint)
 	AMD64Host     = []configuration.Host{}
 	ARM64Host     = []configuration.Host{}
+	// 校验、分发、启动、巡检和清理共用与各个节点的连接
+	pool = remote.NewPool(keepaliveInterval)
 )
 
+// execTimeout 单条远程命令的超时时间，避免节点异常时一直等待
+const execTimeout = 5 * time.Minute
+
+// keepaliveInterval 巡检间隔较长，定期发送保活请求避免连接被断开
+const keepaliveInterval = 30 * time.Second
+
+// cli 返回节点的连接，连接断开时重新连接
+func (t nodeTask) cli() (*remote.Cli, error) {
+	return pool.Get(t.host)
+}
+
 func (op *Options) Run() {
+	defer pool.CloseAll()
+	defer stopServe()
 	startTime := time.Now()
-	_ = os.RemoveAll("/tmp/report")
-	err := os.Mkdir("/tmp/report", 0644)
+	st := newState(op, startTime)
+	if op.Resume {
+		// 继续上一次的转换，保留已经收集到的结果
+		var err error
+		if st, err = loadState(); err != nil {
+			log.Info(err.Error())
+			return
+		}
+		st.Settings.apply(op)
+		startTime = st.StartTime
+		log.Info(fmt.Sprintf("继续%s开始的批量转换", startTime.Format("2006-01-02 15:04:05")))
+	} else {
+		_ = os.RemoveAll("/tmp/report")
+	}
+	err := os.MkdirAll("/tmp/report", 0644)
 	if err != nil {
 		log.Info(err.Error())
 		return
 	}
 	// 第一步：初始化配置文件
 	log.Info("建立与各个节点的连接...")
+	op.setupHostKeys()
 	res, errNum, err := op.ConfigValidation()
 	if err != nil {
 		log.Info(fmt.Sprintf("校验失败: %s,详细信息见report.html", err.Error()))
 		generateErrorReport(startTime, res, errNum, nil)
 		return
 	}
+	// 只有尚未分发文件的节点需要清理环境和分发文件，其余节点从所处的阶段继续
+	pending := []configuration.Host{}
+	for _, h := range configuration.Instance.Hosts {
+		if _, ok := nodeTaskMap[h.IP]; !ok {
+			continue
+		}
+		if st.failed(h.IP) {
+			// 上一次失败的结果保留在节点上，重新分发前移动到archive目录
+			log.Info(fmt.Sprintf("节点%s上一次转换失败，重新转换", h.IP))
+			_ = os.Remove(fmt.Sprintf("/tmp/report/%s.yaml", h.IP))
+			_ = os.Remove(fmt.Sprintf("/tmp/report/%s.errorlog", h.IP))
+			if err = st.retry(h.IP); err != nil {
+				log.Info(err.Error())
+				generateErrorReport(startTime, []report.CaseInfo{}, 0, err)
+				return
+			}
+		}
+		if !st.reached(h.IP, phaseConnected) {
+			if err = st.setPhase(h.IP, phaseConnected); err != nil {
+				log.Info(err.Error())
+				generateErrorReport(startTime, []report.CaseInfo{}, 0, err)
+				return
+			}
+		}
+		if !st.reached(h.IP, phaseDispatched) {
+			pending = append(pending, h)
+		}
+	}
 
 	// 第三步：分发二进制文件到各个节点，并启动
+	// 保留上一次转换在节点上留下的结果文件和日志，避免被本次转换覆盖或误判为本次的结果
+	archiveCmd := fmt.Sprintf("cd /tmp/precheck && files=`ls %s 2>/dev/null`; if [ -n \"$files\" ]; then dir=archive/`date +%%Y%%m%%d%%H%%M%%S`; sudo mkdir -p $dir && sudo mv $files $dir/; fi",
+		strings.Join(resultFiles, " "))
 	envInit1 := remote.Command{
 		Cmds: []string{"sudo mkdir -p /tmp/precheck",
 			"sudo chmod 777 /tmp/precheck",
-			"sudo rm -rf /tmp/precheck/error.log",
-			fmt.Sprintf("sudo kill -9 `cat /tmp/precheck/%s`", httppid),
-			fmt.Sprintf("sudo kill -9 `cat /tmp/precheck/%s`", checkpid),
+			// 以前的版本会分发包含各节点凭据的配置文件
+			fmt.Sprintf("sudo rm -f /tmp/precheck/%s /tmp/precheck/%s", kubeconfigFile, configFile),
+			fmt.Sprintf("sudo kill -9 `cat /tmp/precheck/%s 2>/dev/null` 2>/dev/null || true", httppid),
+			fmt.Sprintf("sudo kill -9 `cat /tmp/precheck/%s 2>/dev/null` 2>/dev/null || true", checkpid),
+			archiveCmd,
 		},
+		Timeout: execTimeout,
 	}
 
+	// 转换进程退出后立即删除分发的kubeconfig，无论转换是否成功、主控节点是否仍在巡检
 	envInit3 := remote.Command{
-		Cmds: []string{fmt.Sprintf("transform kubelet -v %s -r %s"), op.KubeVersion, op.Runtime},
+		Cmds: []string{op.startCmd()},
+		Timeout: execTimeout,
 	}
 
 	cleanCmd := remote.Command{
-		Cmds: []string{fmt.Sprintf("sudo kill -9 `cat /tmp/precheck/%s`", httppid), "sudo rm -rf /tmp/precheck"},
+		Cmds:    []string{fmt.Sprintf("sudo kill -9 `cat /tmp/precheck/%s 2>/dev/null` 2>/dev/null || true", httppid), "sudo rm -rf /tmp/precheck"},
+		Timeout: execTimeout,
 	}
 
-	result := remote.Run(configuration.Instance.Hosts, envInit1)
-	if len(result) > 0 {
-		errs := "环境清理失败: "
-		for key, value := range result {
-			errs += fmt.Sprintf("%s,%s ", key, strings.Join(value, ""))
-		}
-		log.Info(errs)
-		generateErrorReport(startTime, []report.CaseInfo{}, 0, errors.New(errs))
+	results := pool.Run(pending, envInit1)
+	if cases := hostResultCases("环境清理", results); len(cases) > 0 {
+		generateErrorReport(startTime, cases, len(cases), errors.New("环境清理失败"))
 		return
 	}
 
 	log.Info("开始分发检查文件...")
-	configName := path.Base(op.File)
+	sources := map[string]string{}
 	if len(AMD64Host) > 0 || len(ARM64Host) > 0 {
 		log.Info("分发文件到各个节点...")
 		pwd, _ := os.Getwd()
-		result = remote.Run(AMD64Host, disPatchScript(pwd+"/transform_amd64", op.File, "transform_amd64", configName))
-		if len(result) > 0 {
-			for key, value := range result {
-				log.Info(fmt.Sprintf("%s: %s", key, strings.Join(value, "")))
-			}
-			generateErrorReport(startTime, []report.CaseInfo{}, 0, errors.New("分发文件失败"))
+		results = op.distributeTo(pendingHosts(AMD64Host, pending), pwd+"/transform_amd64", "transform_amd64", sources)
+		if cases := hostResultCases("分发文件", results); len(cases) > 0 {
+			generateErrorReport(startTime, cases, len(cases), errors.New("分发文件失败"))
 			return
 		}
-		result = remote.Run(ARM64Host, disPatchScript(pwd+"/transform_arm64", op.File, "transform_arm64", configName))
-		if len(result) > 0 {
-			for key, value := range result {
-				log.Info(fmt.Sprintf("%s: %s", key, strings.Join(value, "")))
-			}
-			generateErrorReport(startTime, []report.CaseInfo{}, 0, errors.New("分发文件失败"))
+		logUploads(results)
+		results = op.distributeTo(pendingHosts(ARM64Host, pending), pwd+"/transform_arm64", "transform_arm64", sources)
+		if cases := hostResultCases("分发文件", results); len(cases) > 0 {
+			generateErrorReport(startTime, cases, len(cases), errors.New("分发文件失败"))
 			return
 		}
+		logUploads(results)
 	} else {
 		// 获取本服务二进制文件
 		exePath, err := os.Executable()
@@ -120,117 +222,41 @@ func (op *Options) Run() {
 			return
 		}
 		fileName := path.Base(exePath)
-		result = remote.Run(configuration.Instance.Hosts, disPatchScript(exePath, op.File, fileName, configName))
-		if len(result) > 0 {
-			for key, value := range result {
-				log.Info(fmt.Sprintf("%s: %s", key, strings.Join(value, "")))
-			}
-			generateErrorReport(startTime, []report.CaseInfo{}, 0, errors.New("分发文件失败"))
+		results = op.distributeTo(pending, exePath, fileName, sources)
+		if cases := hostResultCases("分发文件", results); len(cases) > 0 {
+			generateErrorReport(startTime, cases, len(cases), errors.New("分发文件失败"))
 			return
 		}
+		logUploads(results)
 	}
 
-	result = remote.Run(configuration.Instance.Hosts, envInit3)
-	if len(result) > 0 {
-		for key, value := range result {
-			log.Info(fmt.Sprintf("%s: %s", key, strings.Join(value, "")))
+	for _, h := range pending {
+		// 启用fanout时在报告中记录各节点的文件来源
+		reports := []report.ReportData{}
+		if op.Fanout > 0 {
+			reports = append(reports, distributionReport(h.IP, sources[h.IP]))
+		}
+		if err = st.setPhase(h.IP, phaseDispatched, reports...); err != nil {
+			log.Info(err.Error())
+			generateErrorReport(startTime, []report.CaseInfo{}, 0, err)
+			return
 		}
-		generateErrorReport(startTime, []report.CaseInfo{}, 0, errors.New("启动检查失败"))
-		return
 	}
 
-	// 第四步：定时搜索节点，检查执行结果
-	cycleCmd := []string{fmt.Sprintf("sudo ls /proc/`cat /tmp/precheck/%s`/exe", checkpid), "ls /tmp/precheck"}
-	n := 0
-	noResultReport := []report.ReportData{}
-	// 循环等待直到完成
-	for {
-		if len(nodeTaskMap) == n {
-			break
-		}
-		time.Sleep(15 * time.Second)
-		for k, v := range nodeTaskMap {
-			if _, ok := nodeResultMap[k]; ok {
-				continue
-			}
-			log.Info(fmt.Sprintf("周期巡检节点：%s", k))
-			stdOut, stdErr, err := v.cli.SSH.Exec(cycleCmd[0])
-			log.Info(fmt.Sprintf("巡检输出%s", stdOut))
-			if err != nil {
-				log.Info(err.Error())
-				generateErrorReport(startTime, []report.CaseInfo{}, 0, err)
-				return
-			}
-			if len(stdOut) > 0 {
-				continue
-			}
-			log.Info(fmt.Sprintf("已经完成检查节点: %s", k))
-			stdOut, stdErr, err = v.cli.SSH.Exec(cycleCmd[1])
-			if err != nil {
-				log.Info(err.Error())
-				generateErrorReport(startTime, []report.CaseInfo{}, 0, err)
-				return
-			}
-			if len(stdErr) > 0 {
-				log.Info(strings.Join(stdErr, ""))
-				generateErrorReport(startTime, []report.CaseInfo{}, 0, errors.New(strings.Join(stdErr, "")))
-				return
-			}
-			log.Info(fmt.Sprintf("目标节点%s, 目录文件列表：%s", k, stdOut))
-			for _, s := range stdOut {
-				if s == resultFile {
-					err = v.cli.SFTP.DownloadFile(fmt.Sprintf("/tmp/report/%s.yaml", k), fmt.Sprintf("/tmp/precheck/%s", resultFile))
-					if err != nil {
-						log.Info(err.Error())
-						generateErrorReport(startTime, []report.CaseInfo{}, 0, err)
-						return
-					}
-					nodeResultMap[k] = 0
-					n += 1
-					log.Info(fmt.Sprintf("测试成功，测试结果收集完成: %s", k))
-				}
-				if s == errorFile {
-					err = v.cli.SFTP.DownloadFile(fmt.Sprintf("/tmp/report%s.errorlog", k), fmt.Sprintf("/tmp/precheck/%s", errorFile))
-					if err != nil {
-						log.Info(err.Error())
-						generateErrorReport(startTime, []report.CaseInfo{}, 0, err)
-						return
-					}
-					nodeResultMap[k] = 0
-					n += 1
-					log.Info(fmt.Sprintf("测试失败，请查看/tmp/report/%s.errorlog", k))
-				}
-			}
-			if _, ok := nodeResultMap[k]; !ok {
-				log.Info(fmt.Sprintf("节点%s收集检查结果失败", k))
-				nodeResultMap[k] = 0
-				n += 1
-				noResultReport = append(noResultReport, report.ReportData{
-					StartTime:    "",
-					DurationTime: "",
-					RandomSeed:   "",
-					Total:        1,
-					Success:      0,
-					Failure:      1,
-					Warning:      0,
-					Result:       report.NOTPASS,
-					Case: []report.CaseInfo{
-						{
-							IP:           k,
-							Name:         "收集测试结果",
-							Status:       report.Failure,
-							Detail:       "任务执行异常，未能收集到检查结果，请确认用户是否有免密root权限或者其他异常导致结果文件丢失",
-							DurationTime: "0",
-						},
-					},
-					Server: nil,
-				})
-			}
-		}
+	// 第四步：按批次启动转换，定时巡检节点，检查执行结果
+	rolloutReport, err := op.rollout(st, envInit3)
+	op.removeKubeConfig(st)
+	if err != nil {
+		log.Info(err.Error())
+		generateErrorReport(startTime, []report.CaseInfo{}, 0, err)
+		return
 	}
 	// 第五步：执行完成，收集结果
-	reportList := []report.ReportData{}
-	reportList = append(reportList, noResultReport...)
+	if op.Resume {
+		op.recollect(st)
+	}
+	reportList := st.reports()
+	reportList = append(reportList, rolloutReport...)
 	// 获取/tmp/report目录下所有文件
 	files, err := os.ReadDir("/tmp/report")
 	if err != nil {
@@ -286,6 +312,14 @@ func (op *Options) Run() {
 				log.Info(err.Error())
 				continue
 			}
+			// 使用配置文件中的节点地址
+			ip := strings.TrimSuffix(file.Name(), ".yaml")
+			for i := range rep.Case {
+				rep.Case[i].IP = ip
+			}
+			for i := range rep.Plan {
+				rep.Plan[i].IP = ip
+			}
 			reportList = append(reportList, rep)
 			continue
 		}
@@ -296,18 +330,91 @@ func (op *Options) Run() {
 		generateErrorReport(startTime, []report.CaseInfo{}, 0, err)
 		return
 	}
-	// 第六步：生成报告，清理各个节点
-	_ = os.RemoveAll("/tmp/report")
-	result = remote.Run(configuration.Instance.Hosts, cleanCmd)
-	if len(result) > 0 {
-		for key, value := range result {
-			log.Info(fmt.Sprintf("%s: %s", key, strings.Join(value, "")))
+	// 第六步：生成报告，清理转换成功的节点，失败的节点保留结果文件和日志用于排查
+	finished := []configuration.Host{}
+	for _, h := range configuration.Instance.Hosts {
+		if !st.reached(h.IP, phaseConverted) {
+			continue
 		}
+		finished = append(finished, h)
+		if err = st.setPhase(h.IP, phaseCollected); err != nil {
+			log.Info(err.Error())
+		}
+	}
+	_ = os.RemoveAll("/tmp/report")
+	results = pool.RunWithLimit(finished, cleanCmd, op.MaxParallel)
+	if cases := hostResultCases("清理节点", results); len(cases) > 0 {
+		return
+	}
+	if len(finished) == len(nodeTaskMap) {
+		// 所有节点都已完成，不再需要继续
+		_ = os.Remove(stateFile)
+	}
+	if op.Plan {
+		log.Info("转换计划生成完成: report.html")
 		return
 	}
 	log.Info(fmt.Sprintf("预检报告生成完成: report.html"))
 }
 
+// publicKey 返回base64编码的minisign公钥，key是公钥文件时读取文件的最后一行
+func publicKey(key string) string {
+	if b, err := os.ReadFile(key); err == nil {
+		lines := strings.Split(strings.TrimSpace(string(b)), "\n")
+		return strings.TrimSpace(lines[len(lines)-1])
+	}
+	return strings.TrimSpace(key)
+}
+
+// startCmd 在节点后台启动transform kubelet，节点断开连接后继续执行
+func (op *Options) startCmd() string {
+	script := fmt.Sprintf("(trap \"\" HUP; ./transform kubelet %s --result-dir /tmp/precheck >/tmp/precheck/transform.log 2>&1; rm -f /tmp/precheck/%s) </dev/null >/dev/null 2>&1 & echo $! > /tmp/precheck/%s",
+		op.kubeletArgs(), kubeconfigFile, checkpid)
+	return "cd /tmp/precheck && sudo sh -c " + remote.Quote(script)
+}
+
+// kubeletArgs 节点上执行transform kubelet的参数，每个参数都经过shell转义
+func (op *Options) kubeletArgs() string {
+	args := []string{"-p", op.HttpRepo, "-t", strconv.FormatInt(op.Timeout, 10)}
+	if op.Runtime != "" {
+		args = append(args, "-r", op.Runtime)
+	}
+	if op.KubeVersion != "" {
+		args = append(args, "-v", op.KubeVersion)
+	}
+	if op.FromImage {
+		args = append(args, "--from-image")
+	}
+	if op.Plan {
+		args = append(args, "--dry-run")
+	}
+	if op.Cordon || op.Drain {
+		args = append(args, "--kubeconfig", "/tmp/precheck/"+kubeconfigFile)
+	}
+	if op.Cordon {
+		args = append(args, "--cordon")
+	}
+	if op.Drain {
+		args = append(args, "--drain", "--drain-timeout", strconv.FormatInt(op.DrainTimeout, 10))
+	}
+	if op.Drain && op.DrainForce {
+		args = append(args, "--drain-force")
+	}
+	if op.ArtifactSource != "" {
+		args = append(args, "--artifact-source", op.ArtifactSource)
+	}
+	if key := publicKey(op.PublicKey); key != "" {
+		args = append(args, "--public-key", key)
+	}
+	if op.InsecureSkipVerify {
+		args = append(args, "--insecure-skip-verify")
+	}
+	for i, arg := range args {
+		args[i] = remote.Quote(arg)
+	}
+	return strings.Join(args, " ")
+}
+
 // ConfigValidation 配置校验
 func (op *Options) ConfigValidation() ([]report.CaseInfo, int, error) {
 	reportCase := []report.CaseInfo{}
@@ -356,6 +463,20 @@ func (op *Options) ConfigValidation() ([]report.CaseInfo, int, error) {
 		return reportCase, 1, errors.New("主机IP地址重复")
 	}
 
+	// 节点从主控节点上的文件下载服务获取二进制文件
+	if err = op.startServe(); err != nil {
+		reportCase = append(reportCase, report.CaseInfo{
+			Identify:     "public",
+			IP:           "",
+			Role:         "配置检查",
+			Name:         "启动文件下载服务",
+			Status:       report.Failure,
+			Detail:       err.Error(),
+			DurationTime: "0",
+		})
+		return reportCase, 1, err
+	}
+
 	mutilArch := true
 
 	amdName := fmt.Sprintf("%s-amd64", transformName)
@@ -378,8 +499,8 @@ func (op *Options) ConfigValidation() ([]report.CaseInfo, int, error) {
 	errNum := 0
 	for _, node := range configuration.Instance.Hosts {
 		startTime := time.Now()
-		if len(node.UserName) == 0 && len(node.Password) == 0 {
-			log.Info(fmt.Sprintf("用户名密码均为空，不检查节点：%s", node.IP))
+		if len(node.UserName) == 0 && !node.HasCredential() {
+			log.Info(fmt.Sprintf("用户名和认证信息均为空，不检查节点：%s", node.IP))
 			continue
 		}
 		if node.IP == "" {
@@ -406,15 +527,15 @@ func (op *Options) ConfigValidation() ([]report.CaseInfo, int, error) {
 				DurationTime: "0",
 			})
 		}
-		if node.Password == "" {
+		if !node.HasCredential() {
 			errNum++
 			reportCase = append(reportCase, report.CaseInfo{
 				Identify:     "ip",
 				IP:           node.IP,
 				Role:         "配置检查",
-				Name:         "password为空",
+				Name:         "认证信息为空",
 				Status:       report.Failure,
-				Detail:       "password为空",
+				Detail:       "password、privateKeyFile、sshAgent至少需要配置一项",
 				DurationTime: "0",
 			})
 		}
@@ -431,24 +552,26 @@ func (op *Options) ConfigValidation() ([]report.CaseInfo, int, error) {
 			})
 		}
 
-		cli, err := remote.NewRemoteClient(&configuration.Host{
-			IP:       node.IP,
-			UserName: node.UserName,
-			Password: node.Password,
-			Port:     node.Port,
-		})
+		host := node
+		cli, err := pool.Get(host)
 
 		if err != nil || cli == nil {
 			errNum++
+			name := "ssh连接"
 			detail := "建立ssh连接失败"
 			if err != nil {
 				detail = err.Error()
 			}
+			var hostKeyErr *remote.HostKeyError
+			if errors.As(err, &hostKeyErr) {
+				name = "主机密钥校验"
+				detail = hostKeyErr.Error()
+			}
 			reportCase = append(reportCase, report.CaseInfo{
 				Identify:     "ip",
 				IP:           node.IP,
 				Role:         "配置检查",
-				Name:         "ssh连接",
+				Name:         name,
 				Status:       report.Failure,
 				Detail:       detail,
 				DurationTime: time.Now().Sub(startTime).String(),
@@ -463,15 +586,34 @@ func (op *Options) ConfigValidation() ([]report.CaseInfo, int, error) {
 				Detail:       "建立ssh连接成功",
 				DurationTime: "0",
 			})
+			// 所有远程命令都通过sudo执行，提前确认sudo可用
+			if result, err := cli.SSH.ExecTimeout("sudo true", execTimeout); err != nil || !result.Success() {
+				detail := ""
+				if err != nil {
+					detail = err.Error()
+				} else {
+					detail = result.Message()
+				}
+				errNum++
+				reportCase = append(reportCase, report.CaseInfo{
+					Identify:     "ip",
+					IP:           node.IP,
+					Role:         "配置检查",
+					Name:         "sudo权限",
+					Status:       report.Failure,
+					Detail:       detail,
+					DurationTime: "0",
+				})
+			}
 			if mutilArch {
-				stdOut, stdErr, err := cli.SSH.Exec("echo $(uname -m | sed 's/x86_64/amd64/;s/aarch64/arm64/;s/^unknown$/amd64/')")
-				if err != nil || len(stdErr) > 0 || len(stdOut) == 0 {
+				result, err := cli.SSH.ExecTimeout("echo $(uname -m | sed 's/x86_64/amd64/;s/aarch64/arm64/;s/^unknown$/amd64/')", execTimeout)
+				if err != nil || !result.Success() || len(result.Stdout) == 0 {
+					errNum++
 					errMessage := ""
 					if err != nil {
 						errMessage += err.Error()
-					}
-					if len(stdErr) > 0 {
-						errMessage += strings.Join(stdErr, ",")
+					} else {
+						errMessage += result.Message()
 					}
 					reportCase = append(reportCase, report.CaseInfo{
 						Identify:     "arch",
@@ -482,8 +624,7 @@ func (op *Options) ConfigValidation() ([]report.CaseInfo, int, error) {
 						Detail:       errMessage,
 						DurationTime: "0",
 					})
-				}
-				if stdOut[0] == "arm64" {
+				} else if result.Stdout[0] == "arm64" {
 					ARM64Host = append(ARM64Host, node)
 				} else {
 					AMD64Host = append(AMD64Host, node)
@@ -492,7 +633,7 @@ func (op *Options) ConfigValidation() ([]report.CaseInfo, int, error) {
 		}
 		nodeTaskMap[node.IP] = nodeTask{
 			ip:   node.IP,
-			cli:  cli,
+			host: node,
 		}
 	}
 	if errNum > 0 {
@@ -550,22 +691,176 @@ func generateErrorReport(startTime time.Time, res []report.CaseInfo, errNum int,
 	}
 }
 
+// hostResultCases 将远程执行失败的节点转换为报告中的检查项
+func hostResultCases(name string, results []remote.HostResult) []report.CaseInfo {
+	cases := []report.CaseInfo{}
+	for _, r := range remote.FailedHosts(results) {
+		log.Info(fmt.Sprintf("%s %s失败(%s): %s", r.IP, name, r.ErrorClass, r.Err))
+		cases = append(cases, report.CaseInfo{
+			Identify:     r.ErrorClass,
+			IP:           r.IP,
+			Role:         "主控节点",
+			Name:         name,
+			Status:       report.Failure,
+			Detail:       r.Err,
+			DurationTime: r.Duration.String(),
+		})
+	}
+	return cases
+}
+
+// logUploads 记录分发到各个节点的文件大小和校验值
+func logUploads(results []remote.HostResult) {
+	for _, r := range results {
+		for _, step := range r.Steps {
+			if step.Kind == remote.StepUpload && !step.Failed() {
+				log.Info(fmt.Sprintf("%s: 分发%s完成, %d字节, 耗时%s, sha256 %s", r.IP, path.Base(step.Name), step.Bytes, step.Duration, step.Checksum))
+			}
+		}
+	}
+}
+
+// rollbackNode 在转换失败的节点上使用本次转换前的备份回滚，恢复容器化的kubelet
+func rollbackNode(ip string, cli *remote.Cli) report.ReportData {
+	startTime := time.Now()
+	log.Info(fmt.Sprintf("节点%s转换失败，开始回滚", ip))
+	rollbackCase := report.CaseInfo{
+		Identify: "rollback",
+		IP:       ip,
+		Role:     "kubelet转换",
+		Name:     "回滚容器化kubelet",
+		Status:   report.Success,
+		Detail:   "已恢复转换前的kubelet容器",
+	}
+	name := ""
+	result, err := cli.SSH.ExecTimeout(fmt.Sprintf("cat /tmp/precheck/%s", snapshotNameFile), execTimeout)
+	if err == nil && result.Success() && len(result.Stdout) > 0 {
+		name = strings.TrimSpace(result.Stdout[0])
+	}
+	if !backup.ValidName(name) {
+		// 不使用其他备份回滚，避免恢复与本次转换无关的旧配置
+		rollbackCase.Status = report.Failure
+		rollbackCase.Detail = "节点已被修改，但未找到本次转换前的备份名称，请在节点上使用transform backup list确认后手动回滚"
+		name = ""
+	} else {
+		rollbackCase.Detail = fmt.Sprintf("已使用备份%s恢复转换前的kubelet容器", name)
+		result, err = cli.SSH.ExecTimeout(fmt.Sprintf("cd /tmp/precheck && sudo ./transform kubelet rollback --snapshot %s >/tmp/precheck/rollback.log 2>&1", name), execTimeout)
+	}
+	switch {
+	case name == "":
+	case err != nil:
+		rollbackCase.Status = report.Failure
+		rollbackCase.Detail = err.Error()
+	case !result.Success():
+		rollbackCase.Status = report.Failure
+		rollbackCase.Detail = fmt.Sprintf("回滚失败(退出码%d)，请查看节点上的/tmp/precheck/rollback.log", result.ExitCode)
+	}
+	rollbackCase.DurationTime = time.Now().Sub(startTime).String()
+	log.Info(fmt.Sprintf("节点%s回滚结果: %s", ip, rollbackCase.Status))
+
+	data := report.ReportData{
+		Total:  1,
+		Result: report.PASS,
+		Case:   []report.CaseInfo{rollbackCase},
+	}
+	if rollbackCase.Status == report.Success {
+		data.Success = 1
+	} else {
+		data.Failure = 1
+		data.Result = report.NOTPASS
+	}
+	return data
+}
+
+// setupHostKeys 设置主机公钥的校验方式，tofu模式下新主机的公钥记录到工作目录的known_hosts中
+func (op *Options) setupHostKeys() {
+	remote.HostKeys.Policy = op.HostKeyCheck
+	remote.HostKeys.ManagedFile = path.Join(global.Workspace, "known_hosts")
+	if op.KnownHosts != "" {
+		remote.HostKeys.KnownHostsFiles = append(remote.HostKeys.KnownHostsFiles, op.KnownHosts)
+	}
+}
+
+// pendingHosts 过滤出需要分发文件的节点
+func pendingHosts(hosts, pending []configuration.Host) []configuration.Host {
+	result := []configuration.Host{}
+	for _, h := range hosts {
+		for _, p := range pending {
+			if h.IP == p.IP {
+				result = append(result, h)
+				break
+			}
+		}
+	}
+	return result
+}
+
+// dispatchScript 分发文件，需要封锁节点时一并分发kubeconfig
+func (op *Options) dispatchScript(binary, binaryName string) remote.Command {
+	cmd := disPatchScript(binary, binaryName)
+	op.addKubeConfig(&cmd)
+	return cmd
+}
+
+// nodeKubeConfig 分发到各节点的kubeconfig，未指定--node-kubeconfig时使用--kubeconfig
+func (op *Options) nodeKubeConfig() string {
+	if op.NodeKubeConfig != "" {
+		return op.NodeKubeConfig
+	}
+	return op.KubeConfig
+}
+
+// addKubeConfig 封锁或驱逐节点时分发kubeconfig
+func (op *Options) addKubeConfig(cmd *remote.Command) {
+	if kubeconfig := op.nodeKubeConfig(); (op.Cordon || op.Drain) && kubeconfig != "" {
+		cmd.FileUp = append(cmd.FileUp, remote.File{Src: kubeconfig, Dst: "/tmp/precheck/"})
+		cmd.Cmds = append(cmd.Cmds,
+			fmt.Sprintf("sudo mv /tmp/precheck/%s /tmp/precheck/%s", path.Base(kubeconfig), kubeconfigFile),
+			fmt.Sprintf("sudo chmod 600 /tmp/precheck/%s", kubeconfigFile))
+	}
+}
+
+// removeKubeConfig 删除未启动或已结束转换的节点上分发的kubeconfig，转换中的节点在转换进程退出后自行删除
+func (op *Options) removeKubeConfig(st *state) {
+	if !op.Cordon && !op.Drain {
+		return
+	}
+	hosts := []configuration.Host{}
+	for _, h := range configuration.Instance.Hosts {
+		if _, ok := nodeTaskMap[h.IP]; !ok || st.phase(h.IP) == phaseConverting {
+			continue
+		}
+		if st.reached(h.IP, phaseDispatched) || st.failed(h.IP) {
+			hosts = append(hosts, h)
+		}
+	}
+	cmd := remote.Command{
+		Cmds:    []string{fmt.Sprintf("sudo rm -f /tmp/precheck/%s", kubeconfigFile)},
+		Timeout: execTimeout,
+	}
+	// 失败的节点已记录在日志中，下一次执行清理环境时会再次删除
+	hostResultCases("删除kubeconfig", pool.RunWithLimit(hosts, cmd, op.MaxParallel))
+}
+
+// dispatch 分发文件到节点，在终端上显示上传进度
+func dispatch(hosts []configuration.Host, cmd remote.Command, limit int) []remote.HostResult {
+	bar := newProgressBar("分发文件")
+	cmd.Progress = bar.update
+	defer bar.done()
+	return pool.RunWithLimit(hosts, cmd, limit)
+}
+
 // dispatch script 分发文件
-func disPatchScript(binary, conf, binaryName, confName string) remote.Command {
+func disPatchScript(binary, binaryName string) remote.Command {
 	return remote.Command{
 		FileUp: []remote.File{
 			{
 				Src: binary,
 				Dst: "/tmp/precheck",
 			},
-			{
-				Src: conf,
-				Dst: "/tmp/precheck/",
-			},
 		},
 		Cmds: []string{
 			fmt.Sprintf("sudo mv /tmp/precheck/%s /tmp/precheck/transform", binaryName),
-			fmt.Sprintf("sudo mv /tmp/precheck/%s /tmp/precheck/nodes.yaml", confName),
 			"sudo chmod +x /tmp/precheck/transform",
 			//"cd /tmp/precheck; sudo nohup ./bc run check >/dev/null 2>&1 &",
 		},
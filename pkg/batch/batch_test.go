@@ -0,0 +1,36 @@
+package batch
+
+import (
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+// TestKubeletArgs 验证参数中的shell特殊字符经过两层sh -c后仍原样传给transform kubelet
+func TestKubeletArgs(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh not found")
+	}
+	op := &Options{HttpRepo: "http://10.0.0.1/files/", Timeout: 2,
+		ArtifactSource: "local=/opt/k8s'; touch /tmp/pwned; '", PublicKey: "RWQ $(id) `id`"}
+	want := []string{"-p", "http://10.0.0.1/files/", "-t", "2",
+		"--artifact-source", "local=/opt/k8s'; touch /tmp/pwned; '", "--public-key", "RWQ $(id) `id`"}
+
+	// 外层sh -c收到的脚本
+	script := strings.TrimPrefix(op.startCmd(), "cd /tmp/precheck && sudo sh -c ")
+	inner, err := exec.Command("sh", "-c", "printf %s "+script).Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(inner), "(trap \"\" HUP; ./transform kubelet "+op.kubeletArgs()+" --result-dir") {
+		t.Errorf("unexpected script: %s", inner)
+	}
+	// 脚本中的参数，用printf代替transform打印收到的参数
+	out, err := exec.Command("sh", "-c", "printf '%s\\n' "+op.kubeletArgs()).Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Split(strings.TrimSuffix(string(out), "\n"), "\n"); strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("arguments = %q, want %q", got, want)
+	}
+}
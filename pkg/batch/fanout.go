@@ -0,0 +1,185 @@
+package batch
+
+import (
+	"fmt"
+	"sync"
+
+	"transform/pkg/configuration"
+	"transform/pkg/remote"
+	"transform/pkg/report"
+	"transform/utils/log"
+)
+
+// distDir 种子节点上提供下载的目录，只包含transform二进制文件
+const distDir = "/tmp/precheck/dist"
+
+// controller 分发来源为主控节点
+const controller = "主控节点"
+
+// distributeTo 分发文件到节点，并记录各节点的文件来源
+func (op *Options) distributeTo(hosts []configuration.Host, binary, binaryName string, sources map[string]string) []remote.HostResult {
+	results, src := op.distribute(hosts, binary, binaryName)
+	for ip, source := range src {
+		sources[ip] = source
+	}
+	return results
+}
+
+// distribute 分发文件到节点。启用fanout时先上传到每种架构的少数种子节点，其余节点从种子节点下载，
+// 下载失败的节点再由主控节点直接上传。返回各节点的执行结果和文件的来源
+func (op *Options) distribute(hosts []configuration.Host, binary, binaryName string) ([]remote.HostResult, map[string]string) {
+	sources := map[string]string{}
+	if op.Fanout <= 0 || len(hosts) <= op.Fanout {
+		for _, h := range hosts {
+			sources[h.IP] = controller
+		}
+		return dispatch(hosts, op.dispatchScript(binary, binaryName), op.MaxParallel), sources
+	}
+
+	seeds, peers := hosts[:op.Fanout], hosts[op.Fanout:]
+	log.Info(fmt.Sprintf("上传文件到种子节点%v，其余%d个节点从种子节点下载", hostIPs(seeds), len(peers)))
+	results := dispatch(seeds, op.dispatchScript(binary, binaryName), op.MaxParallel)
+	for _, h := range seeds {
+		sources[h.IP] = controller
+	}
+	if len(remote.FailedHosts(results)) > 0 {
+		return results, sources
+	}
+	checksum := uploadChecksum(results[0], binary)
+
+	// 启动种子节点上的下载服务，启动失败的种子节点不再分发
+	serving := []configuration.Host{}
+	for _, r := range pool.Run(seeds, op.serveScript()) {
+		if r.Failed() {
+			log.Info(fmt.Sprintf("种子节点%s启动下载服务失败: %s", r.IP, r.Err))
+			continue
+		}
+		for _, h := range seeds {
+			if h.IP == r.IP {
+				serving = append(serving, h)
+			}
+		}
+	}
+	defer pool.Run(serving, remote.Command{
+		Cmds:    []string{fmt.Sprintf("sudo kill -9 `cat /tmp/precheck/%s 2>/dev/null` 2>/dev/null || true", httppid)},
+		Timeout: execTimeout,
+	})
+
+	// 每个种子节点同时最多向MaxParallel个节点分发
+	fallback := []configuration.Host{}
+	if len(serving) == 0 {
+		fallback = peers
+	} else {
+		groups := make([][]configuration.Host, len(serving))
+		for i, h := range peers {
+			groups[i%len(serving)] = append(groups[i%len(serving)], h)
+		}
+		var (
+			mu sync.Mutex
+			wg sync.WaitGroup
+		)
+		for i, group := range groups {
+			wg.Add(1)
+			go func(seed configuration.Host, group []configuration.Host) {
+				defer wg.Done()
+				for _, r := range pool.RunWithLimit(group, op.pullScript(seed.IP, checksum), op.MaxParallel) {
+					mu.Lock()
+					if r.Failed() {
+						log.Info(fmt.Sprintf("节点%s从种子节点%s下载失败，改为从主控节点上传: %s", r.IP, seed.IP, r.Err))
+						for _, h := range group {
+							if h.IP == r.IP {
+								fallback = append(fallback, h)
+							}
+						}
+					} else {
+						sources[r.IP] = seed.IP
+						results = append(results, r)
+					}
+					mu.Unlock()
+				}
+			}(serving[i], group)
+		}
+		wg.Wait()
+	}
+
+	if len(fallback) > 0 {
+		results = append(results, dispatch(fallback, op.dispatchScript(binary, binaryName), op.MaxParallel)...)
+		for _, h := range fallback {
+			sources[h.IP] = controller
+		}
+	}
+	return results, sources
+}
+
+// serveScript 在种子节点上启动transform serve提供transform二进制文件的下载，等待服务开始监听
+func (op *Options) serveScript() remote.Command {
+	return remote.Command{
+		Cmds: []string{
+			fmt.Sprintf("sudo mkdir -p %s", distDir),
+			fmt.Sprintf("sudo cp /tmp/precheck/transform %s/transform", distDir),
+			fmt.Sprintf("cd /tmp/precheck && sudo sh -c 'nohup ./transform serve --dir %s --port %d >/tmp/precheck/serve.log 2>&1 & echo $! > /tmp/precheck/%s'",
+				distDir, op.FanoutPort, httppid),
+			"sleep 1",
+		},
+		Timeout: execTimeout,
+	}
+}
+
+// pullScript 从种子节点下载transform二进制文件并校验sha256
+func (op *Options) pullScript(seed, checksum string) remote.Command {
+	url := fmt.Sprintf("http://%s:%d/transform", seed, op.FanoutPort)
+	part := "/tmp/precheck/transform.part"
+	cmd := remote.Command{
+		Cmds: []string{
+			fmt.Sprintf("curl -fsS --retry 3 -o %s %s || wget -q -t 3 -O %s %s", part, url, part, url),
+			fmt.Sprintf("echo '%s  %s' | sha256sum -c -", checksum, part),
+			fmt.Sprintf("sudo mv %s /tmp/precheck/transform", part),
+			"sudo chmod +x /tmp/precheck/transform",
+		},
+		Timeout: execTimeout,
+	}
+	op.addKubeConfig(&cmd)
+	return cmd
+}
+
+// distributionReport 报告节点的文件来源，组成分发树
+func distributionReport(ip, source string) report.ReportData {
+	detail := fmt.Sprintf("%s -> %s", source, ip)
+	if source != controller {
+		detail = fmt.Sprintf("%s -> 种子节点%s -> %s", controller, source, ip)
+	}
+	return report.ReportData{
+		Total:   1,
+		Success: 1,
+		Result:  report.PASS,
+		Case: []report.CaseInfo{
+			{
+				Identify:     "distribution",
+				IP:           ip,
+				Role:         "文件分发",
+				Name:         "分发来源",
+				Status:       report.Success,
+				Detail:       detail,
+				DurationTime: "0",
+			},
+		},
+	}
+}
+
+// uploadChecksum 返回上传的本地文件的sha256
+func uploadChecksum(r remote.HostResult, file string) string {
+	for _, step := range r.Steps {
+		if step.Kind == remote.StepUpload && step.Name == file {
+			return step.Checksum
+		}
+	}
+	return ""
+}
+
+func hostIPs(hosts []configuration.Host) []string {
+	ips := make([]string, 0, len(hosts))
+	for _, h := range hosts {
+		ips = append(ips, h.IP)
+	}
+	return ips
+}
@@ -0,0 +1,53 @@
+package batch
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestPullScript 验证从种子节点下载后校验sha256，kubeconfig仍由主控节点上传，配置文件不分发到节点
+func TestPullScript(t *testing.T) {
+	op := &Options{File: "/root/nodes.yaml", FanoutPort: 40081, Drain: true}
+	op.KubeConfig = "/root/.kube/config"
+	cmd := op.pullScript("10.0.0.1", "abc")
+	script := strings.Join(cmd.Cmds, "\n")
+	for _, want := range []string{
+		"http://10.0.0.1:40081/transform",
+		"echo 'abc  /tmp/precheck/transform.part' | sha256sum -c -",
+		"sudo mv /tmp/precheck/config /tmp/precheck/kubeconfig",
+	} {
+		if !strings.Contains(script, want) {
+			t.Errorf("pull script does not contain %q:\n%s", want, script)
+		}
+	}
+	if len(cmd.FileUp) != 1 || cmd.FileUp[0].Src != op.KubeConfig {
+		t.Errorf("FileUp = %+v", cmd.FileUp)
+	}
+
+	// 指定--node-kubeconfig时分发权限受限的kubeconfig
+	op.NodeKubeConfig = "/root/drain.kubeconfig"
+	cmd = op.pullScript("10.0.0.1", "abc")
+	if len(cmd.FileUp) != 1 || cmd.FileUp[0].Src != op.NodeKubeConfig ||
+		!strings.Contains(strings.Join(cmd.Cmds, "\n"), "sudo mv /tmp/precheck/drain.kubeconfig /tmp/precheck/kubeconfig") {
+		t.Errorf("FileUp = %+v, Cmds = %q", cmd.FileUp, cmd.Cmds)
+	}
+
+	// 主控节点直接分发时同样只上传二进制文件和kubeconfig
+	cmd = op.dispatchScript("/root/transform_amd64", "transform_amd64")
+	if len(cmd.FileUp) != 2 || cmd.FileUp[0].Src != "/root/transform_amd64" || cmd.FileUp[1].Src != op.NodeKubeConfig {
+		t.Errorf("FileUp = %+v", cmd.FileUp)
+	}
+	if script := strings.Join(cmd.Cmds, "\n"); strings.Contains(script, "nodes.yaml") {
+		t.Errorf("dispatch script references the config file:\n%s", script)
+	}
+}
+
+// TestDistributionReport 验证报告中记录节点的文件来源
+func TestDistributionReport(t *testing.T) {
+	if got := distributionReport("10.0.0.2", controller).Case[0].Detail; got != "主控节点 -> 10.0.0.2" {
+		t.Errorf("Detail = %s", got)
+	}
+	if got := distributionReport("10.0.0.2", "10.0.0.1").Case[0].Detail; got != "主控节点 -> 种子节点10.0.0.1 -> 10.0.0.2" {
+		t.Errorf("Detail = %s", got)
+	}
+}
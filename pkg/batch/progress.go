@@ -0,0 +1,95 @@
+package batch
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// progressWidth 进度条的宽度
+const progressWidth = 30
+
+// progressInterval 两次刷新进度条的最小间隔
+const progressInterval = 200 * time.Millisecond
+
+// progressBar 在终端上显示分发文件的总进度，不是终端时不输出
+type progressBar struct {
+	mu    sync.Mutex
+	out   io.Writer
+	title string
+	// 每个节点每个文件的已上传字节数和总字节数
+	files map[string][2]int64
+	last  time.Time
+}
+
+func newProgressBar(title string) *progressBar {
+	p := &progressBar{title: title, files: map[string][2]int64{}}
+	if fi, err := os.Stderr.Stat(); err == nil && fi.Mode()&os.ModeCharDevice != 0 {
+		p.out = os.Stderr
+	}
+	return p
+}
+
+// update 记录一个文件的上传进度，作为remote.Command的Progress
+func (p *progressBar) update(host, file string, written, total int64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.files[host+":"+file] = [2]int64{written, total}
+	if time.Now().Sub(p.last) >= progressInterval || written == total {
+		p.render()
+	}
+}
+
+// done 输出最终的进度并换行
+func (p *progressBar) done() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(p.files) == 0 || p.out == nil {
+		return
+	}
+	p.render()
+	_, _ = fmt.Fprintln(p.out)
+}
+
+func (p *progressBar) render() {
+	p.last = time.Now()
+	if p.out == nil {
+		return
+	}
+	_, _ = fmt.Fprint(p.out, "\r"+p.line())
+}
+
+func (p *progressBar) line() string {
+	var written, total int64
+	finished := 0
+	for _, f := range p.files {
+		written += f[0]
+		total += f[1]
+		if f[0] == f[1] {
+			finished++
+		}
+	}
+	percent := 100
+	if total > 0 {
+		percent = int(written * 100 / total)
+	}
+	filled := percent * progressWidth / 100
+	bar := strings.Repeat("=", filled) + strings.Repeat(" ", progressWidth-filled)
+	return fmt.Sprintf("%s [%s] %3d%% %s/%s %d/%d", p.title, bar, percent, humanBytes(written), humanBytes(total), finished, len(p.files))
+}
+
+func humanBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%dB", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f%ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,20 @@
+package batch
+
+import "testing"
+
+// TestProgressLine 验证进度条按所有节点所有文件的总字节数计算进度
+func TestProgressLine(t *testing.T) {
+	p := newProgressBar("分发文件")
+	p.out = nil
+	p.update("10.0.0.1", "transform", 512, 1024)
+	p.update("10.0.0.2", "transform", 1024, 1024)
+	want := "分发文件 [======================        ]  75% 1.5KiB/2.0KiB 1/2"
+	if got := p.line(); got != want {
+		t.Errorf("line = %q, want %q", got, want)
+	}
+	for n, want := range map[int64]string{0: "0B", 1023: "1023B", 150 << 20: "150.0MiB"} {
+		if got := humanBytes(n); got != want {
+			t.Errorf("humanBytes(%d) = %s, want %s", n, got, want)
+		}
+	}
+}
@@ -0,0 +1,298 @@
+package batch
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+	"transform/pkg/configuration"
+	"transform/pkg/remote"
+	"transform/pkg/report"
+	"transform/utils"
+	"transform/utils/log"
+)
+
+const (
+	orderFile         = ""
+	orderWorkersFirst = "workers-first"
+	orderGroup        = "group"
+)
+
+// checkRetries 连续巡检失败的次数达到该值时，认为节点转换失败
+const checkRetries = 5
+
+var (
+	// pollInterval 巡检转换中节点的间隔
+	pollInterval = 15 * time.Second
+	// checkNode 巡检节点，测试中替换
+	checkNode = (*Options).checkNode
+)
+
+// rollout 按批次滚动转换节点：同一批次内最多同时转换MaxParallel个节点，
+// 本次执行中失败的节点数超过MaxFailures时停止启动新的节点
+func (op *Options) rollout(st *state, startCmd remote.Command) ([]report.ReportData, error) {
+	stages, err := op.stages(configuration.Instance.Hosts)
+	if err != nil {
+		return nil, err
+	}
+
+	reportList := []report.ReportData{}
+	failures := 0
+	// 各节点连续巡检失败的次数
+	checkErrors := map[string]int{}
+	halted := false
+	skipped := []string{}
+	for i, stage := range stages {
+		queue := []configuration.Host{}
+		running := map[string]configuration.Host{}
+		for _, h := range stage {
+			if _, ok := nodeTaskMap[h.IP]; !ok {
+				continue
+			}
+			switch st.phase(h.IP) {
+			case phaseDispatched:
+				queue = append(queue, h)
+			case phaseConverting:
+				// 上一次执行中断时节点仍在转换，继续巡检
+				running[h.IP] = h
+			default:
+				log.Info(fmt.Sprintf("节点%s处于%s阶段，跳过", h.IP, st.phase(h.IP)))
+			}
+		}
+		if halted {
+			for _, h := range queue {
+				skipped = append(skipped, h.IP)
+			}
+			queue = nil
+		}
+		if len(queue) == 0 && len(running) == 0 {
+			continue
+		}
+		log.Info(fmt.Sprintf("开始第%d批次转换，共%d个节点", i+1, len(queue)+len(running)))
+
+		for len(queue) > 0 || len(running) > 0 {
+			// 启动新的节点，直到达到并发上限
+			for !halted && len(queue) > 0 && (op.MaxParallel <= 0 || len(running) < op.MaxParallel) {
+				h := queue[0]
+				queue = queue[1:]
+				// 先记录为转换中，避免中断后重复启动
+				if err = st.setPhase(h.IP, phaseConverting); err != nil {
+					return nil, err
+				}
+				if result := pool.Run([]configuration.Host{h}, startCmd)[0]; result.Failed() {
+					detail := result.Err
+					log.Info(fmt.Sprintf("%s: %s", h.IP, detail))
+					if err = st.setPhase(h.IP, phaseFailed, failureReport(h.IP, "启动转换", detail)); err != nil {
+						return nil, err
+					}
+					failures++
+					halted = failures > op.MaxFailures
+					continue
+				}
+				running[h.IP] = h
+			}
+			if halted {
+				for _, h := range queue {
+					skipped = append(skipped, h.IP)
+				}
+				queue = nil
+			}
+			if len(running) == 0 {
+				break
+			}
+
+			time.Sleep(pollInterval)
+			for ip := range running {
+				phase, rep, err := checkNode(op, ip, nodeTaskMap[ip])
+				if err != nil {
+					// 巡检失败时在下一次巡检重试，不影响其他节点
+					checkErrors[ip]++
+					log.Info(fmt.Sprintf("巡检节点%s失败(%d/%d): %s", ip, checkErrors[ip], checkRetries, err.Error()))
+					if checkErrors[ip] < checkRetries {
+						continue
+					}
+					phase = phaseFailed
+					rep = []report.ReportData{failureReport(ip, "巡检节点",
+						fmt.Sprintf("连续%d次巡检失败，节点上的转换可能仍在执行，请登录节点确认: %s", checkRetries, err.Error()))}
+				}
+				checkErrors[ip] = 0
+				if phase == "" {
+					continue
+				}
+				delete(running, ip)
+				if err = st.setPhase(ip, phase, rep...); err != nil {
+					return nil, err
+				}
+				if phase == phaseFailed {
+					if failures++; failures > op.MaxFailures {
+						halted = true
+					}
+				}
+			}
+		}
+	}
+
+	if halted {
+		sort.Strings(skipped)
+		detail := fmt.Sprintf("失败节点数%d超过允许的失败数%d，滚动转换已停止，未转换的节点: %s。修复后使用--resume重新转换失败的节点并继续转换剩余节点",
+			failures, op.MaxFailures, strings.Join(skipped, ","))
+		log.Info(detail)
+		reportList = append(reportList, failureReport("主控节点", "滚动转换", detail))
+	}
+	return reportList, nil
+}
+
+// checkNode 巡检节点的执行状态，返回节点所处的阶段，节点仍在执行时返回空
+func (op *Options) checkNode(ip string, task nodeTask) (string, []report.ReportData, error) {
+	cycleCmd := []string{fmt.Sprintf("sudo ls /proc/`cat /tmp/precheck/%s`/exe", checkpid), "ls /tmp/precheck"}
+	log.Info(fmt.Sprintf("周期巡检节点：%s", ip))
+	cli, err := task.cli()
+	if err != nil {
+		return "", nil, err
+	}
+	result, err := cli.SSH.ExecTimeout(cycleCmd[0], execTimeout)
+	if err != nil {
+		return "", nil, err
+	}
+	log.Info(fmt.Sprintf("巡检输出%s", result.Output))
+	// 进程仍然存在
+	if result.Success() {
+		return "", nil, nil
+	}
+	log.Info(fmt.Sprintf("已经完成检查节点: %s", ip))
+	result, err = cli.SSH.ExecTimeout(cycleCmd[1], execTimeout)
+	if err != nil {
+		return "", nil, err
+	}
+	if !result.Success() {
+		return "", nil, errors.New(result.Message())
+	}
+	log.Info(fmt.Sprintf("目标节点%s, 目录文件列表：%s", ip, result.Stdout))
+	files := result.Stdout
+	if utils.ContainsString(files, errorFile) {
+		// 转换失败时result.yaml中包含错误及已经执行的检查，没有时只收集error.log
+		local, remoteFile := failedResult(ip, files)
+		err = cli.SFTP.DownloadFile(local, fmt.Sprintf("/tmp/precheck/%s", remoteFile))
+		if err != nil {
+			return "", nil, err
+		}
+		log.Info(fmt.Sprintf("测试失败，请查看%s", local))
+		if op.Plan {
+			return phaseFailed, nil, nil
+		}
+		// 在修改节点前失败时节点保持原样，不需要回滚
+		if !utils.ContainsString(files, modifiedFile) {
+			log.Info(fmt.Sprintf("节点%s在修改前失败，无需回滚", ip))
+			return phaseFailed, nil, nil
+		}
+		// 转换失败，恢复节点上容器化的kubelet
+		return phaseFailed, []report.ReportData{rollbackNode(ip, cli)}, nil
+	}
+	if utils.ContainsString(files, resultFile) {
+		err = cli.SFTP.DownloadFile(fmt.Sprintf("/tmp/report/%s.yaml", ip), fmt.Sprintf("/tmp/precheck/%s", resultFile))
+		if err != nil {
+			return "", nil, err
+		}
+		log.Info(fmt.Sprintf("测试成功，测试结果收集完成: %s", ip))
+		return phaseConverted, nil, nil
+	}
+	log.Info(fmt.Sprintf("节点%s收集检查结果失败", ip))
+	return phaseFailed, []report.ReportData{
+		failureReport(ip, "收集测试结果", "任务执行异常，未能收集到检查结果，请确认用户是否有免密root权限或者其他异常导致结果文件丢失"),
+	}, nil
+}
+
+// recollect 继续执行时，重新下载已完成但本地结果丢失的节点的结果文件
+func (op *Options) recollect(st *state) {
+	for ip, task := range nodeTaskMap {
+		phase := st.phase(ip)
+		if phase != phaseConverted && phase != phaseFailed {
+			continue
+		}
+		if utils.Exists(fmt.Sprintf("/tmp/report/%s.yaml", ip)) || utils.Exists(fmt.Sprintf("/tmp/report/%s.errorlog", ip)) {
+			continue
+		}
+		cli, err := task.cli()
+		if err != nil {
+			log.Info(fmt.Sprintf("重新收集节点%s的结果失败: %s", ip, err.Error()))
+			continue
+		}
+		local, remoteFile := fmt.Sprintf("/tmp/report/%s.yaml", ip), resultFile
+		if phase == phaseFailed {
+			result, err := cli.SSH.ExecTimeout("ls /tmp/precheck", execTimeout)
+			if err == nil && !result.Success() {
+				err = errors.New(result.Message())
+			}
+			if err != nil {
+				log.Info(fmt.Sprintf("重新收集节点%s的结果失败: %s", ip, err.Error()))
+				continue
+			}
+			local, remoteFile = failedResult(ip, result.Stdout)
+		}
+		if err = cli.SFTP.DownloadFile(local, fmt.Sprintf("/tmp/precheck/%s", remoteFile)); err != nil {
+			log.Info(fmt.Sprintf("重新收集节点%s的结果失败: %s", ip, err.Error()))
+			continue
+		}
+		log.Info(fmt.Sprintf("重新收集节点%s的结果完成", ip))
+	}
+}
+
+// failedResult 转换失败的节点需要收集的结果文件及保存的位置，优先收集包含检查结果的result.yaml
+func failedResult(ip string, files []string) (string, string) {
+	if utils.ContainsString(files, resultFile) {
+		return fmt.Sprintf("/tmp/report/%s.yaml", ip), resultFile
+	}
+	return fmt.Sprintf("/tmp/report/%s.errorlog", ip), errorFile
+}
+
+// stages 按转换顺序将节点分为多个批次，前一批次全部完成后才开始下一批次
+func (op *Options) stages(hosts []configuration.Host) ([][]configuration.Host, error) {
+	switch op.Order {
+	case orderFile:
+		return [][]configuration.Host{hosts}, nil
+	case orderWorkersFirst:
+		workers, controlPlanes := []configuration.Host{}, []configuration.Host{}
+		for _, h := range hosts {
+			if h.IsControlPlane() {
+				controlPlanes = append(controlPlanes, h)
+			} else {
+				workers = append(workers, h)
+			}
+		}
+		return [][]configuration.Host{workers, controlPlanes}, nil
+	case orderGroup:
+		// 按分组在配置文件中首次出现的顺序排列
+		groups := []string{}
+		members := map[string][]configuration.Host{}
+		for _, h := range hosts {
+			if _, ok := members[h.Group]; !ok {
+				groups = append(groups, h.Group)
+			}
+			members[h.Group] = append(members[h.Group], h)
+		}
+		stages := [][]configuration.Host{}
+		for _, g := range groups {
+			stages = append(stages, members[g])
+		}
+		return stages, nil
+	}
+	return nil, fmt.Errorf("unsupported order %q, supported: %s, %s", op.Order, orderWorkersFirst, orderGroup)
+}
+
+func failureReport(ip, name, detail string) report.ReportData {
+	return report.ReportData{
+		Total:   1,
+		Failure: 1,
+		Result:  report.NOTPASS,
+		Case: []report.CaseInfo{
+			{
+				IP:           ip,
+				Name:         name,
+				Status:       report.Failure,
+				Detail:       detail,
+				DurationTime: "0",
+			},
+		},
+	}
+}
@@ -0,0 +1,67 @@
+package batch
+
+import (
+	"errors"
+	"path"
+	"testing"
+	"time"
+	"transform/pkg/configuration"
+	"transform/pkg/remote"
+	"transform/pkg/report"
+)
+
+// TestRolloutCheckErrors 验证巡检失败时继续巡检其他节点，连续失败达到重试次数后记为该节点失败
+func TestRolloutCheckErrors(t *testing.T) {
+	stateFile = path.Join(t.TempDir(), "batch-state.yaml")
+	defer func(interval time.Duration, check func(*Options, string, nodeTask) (string, []report.ReportData, error)) {
+		pollInterval, checkNode = interval, check
+		configuration.Instance.Hosts = nil
+		delete(nodeTaskMap, "10.0.0.1")
+		delete(nodeTaskMap, "10.0.0.2")
+	}(pollInterval, checkNode)
+	pollInterval = time.Millisecond
+
+	configuration.Instance.Hosts = []configuration.Host{{IP: "10.0.0.1"}, {IP: "10.0.0.2"}}
+	st := newState(&Options{}, time.Now())
+	for _, h := range configuration.Instance.Hosts {
+		nodeTaskMap[h.IP] = nodeTask{ip: h.IP, host: h}
+		// 上一次执行中断时节点仍在转换，不需要重新启动
+		if err := st.setPhase(h.IP, phaseConverting); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	checks := map[string]int{}
+	checkNode = func(_ *Options, ip string, _ nodeTask) (string, []report.ReportData, error) {
+		checks[ip]++
+		if ip == "10.0.0.1" {
+			return "", nil, errors.New("connection refused")
+		}
+		// 第一次巡检失败后恢复
+		if checks[ip] == 1 {
+			return "", nil, errors.New("connection reset")
+		}
+		if checks[ip] < 3 {
+			return "", nil, nil
+		}
+		return phaseConverted, nil, nil
+	}
+
+	op := &Options{MaxFailures: 1}
+	reports, err := op.rollout(st, remote.Command{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reports) != 0 {
+		t.Errorf("rollout halted: %+v", reports)
+	}
+	if checks["10.0.0.1"] != checkRetries {
+		t.Errorf("10.0.0.1 checked %d times, want %d", checks["10.0.0.1"], checkRetries)
+	}
+	if st.phase("10.0.0.1") != phaseFailed || len(st.Nodes["10.0.0.1"].Reports) != 1 {
+		t.Errorf("10.0.0.1 phase = %s, reports = %+v", st.phase("10.0.0.1"), st.Nodes["10.0.0.1"].Reports)
+	}
+	if st.phase("10.0.0.2") != phaseConverted {
+		t.Errorf("10.0.0.2 phase = %s", st.phase("10.0.0.2"))
+	}
+}
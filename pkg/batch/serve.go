@@ -0,0 +1,63 @@
+package batch
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+
+	"transform/pkg/configuration"
+	"transform/pkg/serve"
+	"transform/utils/log"
+)
+
+// artifactServer 主控节点上提供kubelet和transform二进制文件下载的服务
+var artifactServer *http.Server
+
+// startServe 在主控节点上启动文件下载服务，并将各节点的--http-repo指向它
+func (op *Options) startServe() error {
+	if op.ServeDir == "" || artifactServer != nil {
+		return nil
+	}
+	address := op.ServeAddress
+	if address == "" {
+		var err error
+		if address, err = localAddress(configuration.Instance.Hosts); err != nil {
+			return err
+		}
+	}
+	s, err := (&serve.Options{Dir: op.ServeDir, Port: op.ServePort}).Start()
+	if err != nil {
+		return err
+	}
+	artifactServer = s
+	op.HttpRepo = fmt.Sprintf("http://%s/", net.JoinHostPort(address, strconv.Itoa(op.ServePort)))
+	log.Info(fmt.Sprintf("各节点从%s下载kubelet", op.HttpRepo))
+	return nil
+}
+
+// stopServe 关闭文件下载服务
+func stopServe() {
+	if artifactServer != nil {
+		_ = artifactServer.Close()
+		artifactServer = nil
+	}
+}
+
+// localAddress 主控节点访问节点时使用的本地地址，经过跳板机时无法确定，需要通过--serve-address指定
+func localAddress(hosts []configuration.Host) (string, error) {
+	if len(hosts) == 0 {
+		return "", errors.New("no host to detect the local address, please specify --serve-address")
+	}
+	if hosts[0].Jump() != nil {
+		return "", errors.New("the nodes are connected through a jump host, please specify --serve-address")
+	}
+	// udp连接不会发送数据，只用于选择路由和本地地址
+	conn, err := net.Dial("udp", net.JoinHostPort(hosts[0].IP, "22"))
+	if err != nil {
+		return "", fmt.Errorf("failed to detect the local address, please specify --serve-address: %v", err)
+	}
+	defer conn.Close()
+	return conn.LocalAddr().(*net.UDPAddr).IP.String(), nil
+}
@@ -0,0 +1,46 @@
+package batch
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path"
+	"testing"
+
+	"transform/pkg/configuration"
+)
+
+// TestStartServe 验证启动文件下载服务后--http-repo指向主控节点
+func TestStartServe(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(path.Join(dir, "kubelet-1.21.13-amd64"), []byte("kubelet"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := l.Addr().(*net.TCPAddr).Port
+	_ = l.Close()
+
+	defer func(hosts []configuration.Host) { configuration.Instance.Hosts = hosts }(configuration.Instance.Hosts)
+	configuration.Instance.Hosts = []configuration.Host{{IP: "127.0.0.1"}}
+	op := &Options{ServeDir: dir, ServePort: port}
+	if err = op.startServe(); err != nil {
+		t.Fatal(err)
+	}
+	defer stopServe()
+	if want := fmt.Sprintf("http://127.0.0.1:%d/", port); op.HttpRepo != want {
+		t.Errorf("HttpRepo = %s, want %s", op.HttpRepo, want)
+	}
+	resp, err := http.Get(op.HttpRepo + "kubelet-1.21.13-amd64")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if b, _ := io.ReadAll(resp.Body); string(b) != "kubelet" {
+		t.Errorf("downloaded %q", b)
+	}
+}
@@ -0,0 +1,231 @@
+package batch
+
+import (
+	"errors"
+	"os"
+	"sort"
+	"time"
+	"transform/pkg/report"
+
+	"gopkg.in/yaml.v3"
+)
+
+// 节点在批量转换中所处的阶段，除failed外按先后顺序排列
+const (
+	phaseConnected  = "connected"
+	phaseDispatched = "dispatched"
+	phaseConverting = "converting"
+	phaseConverted  = "converted"
+	phaseCollected  = "collected"
+	// 失败的节点不属于先后顺序中的任何阶段，保留节点上的结果文件，继续执行时重新转换
+	phaseFailed = "failed"
+)
+
+var phases = []string{"", phaseConnected, phaseDispatched, phaseConverting, phaseConverted, phaseCollected}
+
+var stateFile = "batch-state.yaml"
+
+// state 批量转换的状态，保存在工作目录中，主控节点中断后可以使用--resume从中断处继续
+type state struct {
+	StartTime time.Time             `yaml:"startTime"`
+	Settings  settings              `yaml:"settings"`
+	Nodes     map[string]*nodeState `yaml:"nodes"`
+}
+
+// settings 本次转换使用的参数，继续执行时沿用，保证各节点的转换一致
+type settings struct {
+	HttpRepo     string `yaml:"httpRepo"`
+	KubeVersion  string `yaml:"kubeVersion"`
+	Runtime      string `yaml:"runtime"`
+	Timeout      int64  `yaml:"timeout"`
+	Plan         bool   `yaml:"plan"`
+	MaxParallel  int    `yaml:"maxParallel"`
+	MaxFailures  int    `yaml:"maxFailures"`
+	Order        string `yaml:"order"`
+	Cordon       bool   `yaml:"cordon"`
+	Drain        bool   `yaml:"drain"`
+	DrainTimeout int64  `yaml:"drainTimeout"`
+	// 继续执行时重新启动主控节点上的文件下载服务
+	ServeDir     string `yaml:"serveDir,omitempty"`
+	ServePort    int    `yaml:"servePort,omitempty"`
+	ServeAddress string `yaml:"serveAddress,omitempty"`
+	// kubelet二进制文件的来源及校验方式
+	ArtifactSource     string `yaml:"artifactSource,omitempty"`
+	FromImage          bool   `yaml:"fromImage,omitempty"`
+	PublicKey          string `yaml:"publicKey,omitempty"`
+	InsecureSkipVerify bool   `yaml:"insecureSkipVerify,omitempty"`
+	DrainForce         bool   `yaml:"drainForce,omitempty"`
+	NodeKubeConfig     string `yaml:"nodeKubeConfig,omitempty"`
+	// 继续执行时使用相同的主机公钥校验方式和文件分发方式
+	HostKeyCheck string `yaml:"hostKeyCheck,omitempty"`
+	KnownHosts   string `yaml:"knownHosts,omitempty"`
+	Fanout       int    `yaml:"fanout,omitempty"`
+	FanoutPort   int    `yaml:"fanoutPort,omitempty"`
+}
+
+type nodeState struct {
+	Phase     string    `yaml:"phase"`
+	Failed    bool      `yaml:"failed"`
+	UpdatedAt time.Time `yaml:"updatedAt"`
+	// 主控节点上生成的报告，例如回滚结果、未收集到结果等
+	Reports []report.ReportData `yaml:"reports,omitempty"`
+}
+
+func newState(op *Options, startTime time.Time) *state {
+	return &state{
+		StartTime: startTime,
+		Settings: settings{
+			HttpRepo:           op.HttpRepo,
+			ArtifactSource:     op.ArtifactSource,
+			FromImage:          op.FromImage,
+			KubeVersion:        op.KubeVersion,
+			Runtime:            op.Runtime,
+			Timeout:            op.Timeout,
+			Plan:               op.Plan,
+			MaxParallel:        op.MaxParallel,
+			MaxFailures:        op.MaxFailures,
+			Order:              op.Order,
+			Cordon:             op.Cordon,
+			Drain:              op.Drain,
+			DrainTimeout:       op.DrainTimeout,
+			ServeDir:           op.ServeDir,
+			ServePort:          op.ServePort,
+			ServeAddress:       op.ServeAddress,
+			PublicKey:          op.PublicKey,
+			InsecureSkipVerify: op.InsecureSkipVerify,
+			DrainForce:         op.DrainForce,
+			NodeKubeConfig:     op.nodeKubeConfig(),
+			HostKeyCheck:       op.HostKeyCheck,
+			KnownHosts:         op.KnownHosts,
+			Fanout:             op.Fanout,
+			FanoutPort:         op.FanoutPort,
+		},
+		Nodes: map[string]*nodeState{},
+	}
+}
+
+// loadState 读取上一次中断的批量转换状态
+func loadState() (*state, error) {
+	b, err := os.ReadFile(stateFile)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, errors.New("no batch state found in " + stateFile + ", please run without --resume")
+		}
+		return nil, err
+	}
+	s := &state{}
+	if err = yaml.Unmarshal(b, s); err != nil {
+		return nil, err
+	}
+	if s.Nodes == nil {
+		s.Nodes = map[string]*nodeState{}
+	}
+	return s, nil
+}
+
+// apply 使用状态文件中记录的参数
+func (s *settings) apply(op *Options) {
+	op.HttpRepo = s.HttpRepo
+	op.ArtifactSource = s.ArtifactSource
+	op.FromImage = s.FromImage
+	op.KubeVersion = s.KubeVersion
+	op.Runtime = s.Runtime
+	op.Timeout = s.Timeout
+	op.Plan = s.Plan
+	op.MaxParallel = s.MaxParallel
+	op.MaxFailures = s.MaxFailures
+	op.Order = s.Order
+	op.Cordon = s.Cordon
+	op.Drain = s.Drain
+	op.DrainTimeout = s.DrainTimeout
+	op.DrainForce = s.DrainForce
+	op.NodeKubeConfig = s.NodeKubeConfig
+	op.ServeDir = s.ServeDir
+	op.ServePort = s.ServePort
+	op.ServeAddress = s.ServeAddress
+	op.PublicKey = s.PublicKey
+	op.InsecureSkipVerify = s.InsecureSkipVerify
+	op.HostKeyCheck = s.HostKeyCheck
+	op.KnownHosts = s.KnownHosts
+	op.Fanout = s.Fanout
+	op.FanoutPort = s.FanoutPort
+}
+
+func (s *state) save() error {
+	b, err := yaml.Marshal(s)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(stateFile, b, 0644)
+}
+
+// setPhase 更新节点所处的阶段并立即写入文件
+func (s *state) setPhase(ip, phase string, reports ...report.ReportData) error {
+	n, ok := s.Nodes[ip]
+	if !ok {
+		n = &nodeState{}
+		s.Nodes[ip] = n
+	}
+	n.Phase = phase
+	n.UpdatedAt = time.Now()
+	if phase == phaseFailed {
+		n.Failed = true
+	}
+	n.Reports = append(n.Reports, reports...)
+	return s.save()
+}
+
+func (s *state) phase(ip string) string {
+	if n, ok := s.Nodes[ip]; ok {
+		return n.Phase
+	}
+	return ""
+}
+
+// reached 节点是否已经到达指定阶段，失败的节点没有到达任何阶段
+func (s *state) reached(ip, phase string) bool {
+	if s.failed(ip) {
+		return false
+	}
+	return phaseIndex(s.phase(ip)) >= phaseIndex(phase)
+}
+
+// failed 节点在上一次执行中转换失败
+func (s *state) failed(ip string) bool {
+	return s.phase(ip) == phaseFailed
+}
+
+// retry 重新转换失败的节点，丢弃上一次失败时主控节点生成的报告
+func (s *state) retry(ip string) error {
+	n, ok := s.Nodes[ip]
+	if !ok {
+		return nil
+	}
+	n.Phase = phaseConnected
+	n.UpdatedAt = time.Now()
+	n.Reports = nil
+	return s.save()
+}
+
+// reports 主控节点上生成的所有报告，按节点排序
+func (s *state) reports() []report.ReportData {
+	ips := make([]string, 0, len(s.Nodes))
+	for ip := range s.Nodes {
+		ips = append(ips, ip)
+	}
+	sort.Strings(ips)
+	reports := []report.ReportData{}
+	for _, ip := range ips {
+		reports = append(reports, s.Nodes[ip].Reports...)
+	}
+	return reports
+}
+
+func phaseIndex(phase string) int {
+	for i, p := range phases {
+		if p == phase {
+			return i
+		}
+	}
+	return 0
+}
@@ -0,0 +1,73 @@
+package batch
+
+import (
+	"path"
+	"testing"
+	"time"
+)
+
+// TestStateResume 验证状态文件写入后可以按节点所处的阶段继续执行
+func TestStateResume(t *testing.T) {
+	stateFile = path.Join(t.TempDir(), "batch-state.yaml")
+
+	op := &Options{KubeVersion: "1.21.13", Runtime: "containerd", Timeout: 5, MaxParallel: 2, Order: orderWorkersFirst,
+		HostKeyCheck: "tofu", KnownHosts: "/root/known_hosts", Fanout: 2, FanoutPort: 40081}
+	st := newState(op, time.Now())
+	if err := st.setPhase("10.0.0.1", phaseConverted); err != nil {
+		t.Fatal(err)
+	}
+	if err := st.setPhase("10.0.0.2", phaseConverting); err != nil {
+		t.Fatal(err)
+	}
+	if err := st.setPhase("10.0.0.3", phaseFailed, failureReport("10.0.0.3", "启动转换", "connection reset")); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := loadState()
+	if err != nil {
+		t.Fatal(err)
+	}
+	resumed := &Options{}
+	loaded.Settings.apply(resumed)
+	if resumed.KubeVersion != "1.21.13" || resumed.Runtime != "containerd" || resumed.MaxParallel != 2 || resumed.Order != orderWorkersFirst ||
+		resumed.HostKeyCheck != "tofu" || resumed.KnownHosts != "/root/known_hosts" || resumed.Fanout != 2 || resumed.FanoutPort != 40081 {
+		t.Errorf("settings not restored: %+v", loaded.Settings)
+	}
+
+	tests := []struct {
+		ip      string
+		phase   string
+		reached bool
+	}{
+		{"10.0.0.1", phaseConverted, true},
+		{"10.0.0.1", phaseCollected, false},
+		{"10.0.0.2", phaseDispatched, true},
+		{"10.0.0.2", phaseConverted, false},
+		// 失败的节点不能被当作已完成收集和清理，也需要重新分发
+		{"10.0.0.3", phaseConverted, false},
+		{"10.0.0.3", phaseDispatched, false},
+		{"10.0.0.4", phaseConnected, false},
+	}
+	for _, tt := range tests {
+		if got := loaded.reached(tt.ip, tt.phase); got != tt.reached {
+			t.Errorf("reached(%s, %s) = %v, want %v", tt.ip, tt.phase, got, tt.reached)
+		}
+	}
+	if !loaded.Nodes["10.0.0.3"].Failed {
+		t.Error("failed node is not marked as failed")
+	}
+	if reports := loaded.reports(); len(reports) != 1 || reports[0].Case[0].Detail != "connection reset" {
+		t.Errorf("unexpected reports: %+v", reports)
+	}
+
+	// 重新转换失败的节点时从连接阶段开始，丢弃上一次的报告
+	if err = loaded.retry("10.0.0.3"); err != nil {
+		t.Fatal(err)
+	}
+	if loaded.failed("10.0.0.3") || !loaded.reached("10.0.0.3", phaseConnected) || loaded.reached("10.0.0.3", phaseDispatched) {
+		t.Errorf("phase after retry = %s", loaded.phase("10.0.0.3"))
+	}
+	if reports := loaded.reports(); len(reports) != 0 {
+		t.Errorf("reports after retry: %+v", reports)
+	}
+}
@@ -0,0 +1,218 @@
+package cluster
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"transform/utils/log"
+
+	corev1 "k8s.io/api/core/v1"
+	policyv1 "k8s.io/api/policy/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// 静态pod的注解，由kubelet直接管理，不能驱逐
+const mirrorPodAnnotation = "kubernetes.io/config.mirror"
+
+// 轮询节点和pod状态的间隔
+var pollInterval = 5 * time.Second
+
+// ErrUnmanagedPods 节点上有不受控制器管理的pod，驱逐后不会被重新创建
+var ErrUnmanagedPods = errors.New("pods not managed by a controller would be deleted permanently")
+
+// DrainOptions 驱逐节点上pod的选项
+type DrainOptions struct {
+	// 等待所有pod驱逐完成的超时时间
+	Timeout time.Duration
+	// pod的优雅退出时间，小于0时使用pod自身的配置
+	GracePeriodSeconds int64
+	// 同时驱逐不受控制器管理的pod，与kubectl drain --force相同，默认拒绝驱逐
+	Force bool
+}
+
+// NewClient 使用kubeconfig创建kubernetes客户端
+func NewClient(kubeconfig string) (kubernetes.Interface, error) {
+	config, err := clientcmd.BuildConfigFromFlags("", kubeconfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load kubeconfig %s: %v", kubeconfig, err)
+	}
+	return kubernetes.NewForConfig(config)
+}
+
+// FindNode 按节点名称或节点地址查找节点，candidates中任意一个匹配即可
+func FindNode(ctx context.Context, client kubernetes.Interface, candidates []string) (string, error) {
+	nodes, err := client.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return "", err
+	}
+	for _, c := range candidates {
+		if c == "" {
+			continue
+		}
+		for _, node := range nodes.Items {
+			if node.Name == c || node.Labels[corev1.LabelHostname] == c {
+				return node.Name, nil
+			}
+			for _, addr := range node.Status.Addresses {
+				if addr.Address == c {
+					return node.Name, nil
+				}
+			}
+		}
+	}
+	return "", fmt.Errorf("no node matches %s", strings.Join(candidates, ","))
+}
+
+// IsCordoned 节点是否已经被封锁
+func IsCordoned(ctx context.Context, client kubernetes.Interface, name string) (bool, error) {
+	node, err := client.CoreV1().Nodes().Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return false, err
+	}
+	return node.Spec.Unschedulable, nil
+}
+
+// Cordon 设置节点是否可调度
+func Cordon(ctx context.Context, client kubernetes.Interface, name string, unschedulable bool) error {
+	patch, err := json.Marshal(map[string]interface{}{
+		"spec": map[string]interface{}{"unschedulable": unschedulable},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = client.CoreV1().Nodes().Patch(ctx, name, types.StrategicMergePatchType, patch, metav1.PatchOptions{})
+	return err
+}
+
+// Drain 通过eviction驱逐节点上的pod，遵守PodDisruptionBudget，
+// 被PDB阻止时在超时时间内重试，DaemonSet和静态pod不驱逐
+func Drain(ctx context.Context, client kubernetes.Interface, name string, opts DrainOptions) error {
+	pods, err := client.CoreV1().Pods(metav1.NamespaceAll).List(ctx, metav1.ListOptions{
+		FieldSelector: fields.OneTermEqualSelector("spec.nodeName", name).String(),
+	})
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, opts.Timeout)
+	defer cancel()
+
+	// 与kubectl drain相同，有不受控制器管理的pod时，未指定Force则不驱逐任何pod
+	targets := []corev1.Pod{}
+	unmanaged := []string{}
+	for _, pod := range pods.Items {
+		if !evictable(pod) {
+			continue
+		}
+		if controllerOf(pod) == nil {
+			unmanaged = append(unmanaged, pod.Namespace+"/"+pod.Name)
+		}
+		targets = append(targets, pod)
+	}
+	if len(unmanaged) > 0 {
+		if !opts.Force {
+			return fmt.Errorf("%w: %s", ErrUnmanagedPods, strings.Join(unmanaged, ","))
+		}
+		log.BKEFormat(log.WARN, fmt.Sprintf("deleting pods not managed by a controller: %s", strings.Join(unmanaged, ",")))
+	}
+
+	evicted := []corev1.Pod{}
+	for _, pod := range targets {
+		if err = evict(ctx, client, pod, opts.GracePeriodSeconds); err != nil {
+			return fmt.Errorf("failed to evict pod %s/%s: %v", pod.Namespace, pod.Name, err)
+		}
+		log.Infof("pod %s/%s evicted", pod.Namespace, pod.Name)
+		evicted = append(evicted, pod)
+	}
+
+	// 等待被驱逐的pod删除完成
+	for _, pod := range evicted {
+		err = wait.PollUntilContextCancel(ctx, pollInterval, true, func(ctx context.Context) (bool, error) {
+			p, err := client.CoreV1().Pods(pod.Namespace).Get(ctx, pod.Name, metav1.GetOptions{})
+			if apierrors.IsNotFound(err) || (err == nil && p.UID != pod.UID) {
+				return true, nil
+			}
+			return false, err
+		})
+		if err != nil {
+			return fmt.Errorf("pod %s/%s is not deleted: %v", pod.Namespace, pod.Name, err)
+		}
+	}
+	return nil
+}
+
+// evict 驱逐单个pod，被PDB阻止(429)时重试
+func evict(ctx context.Context, client kubernetes.Interface, pod corev1.Pod, gracePeriod int64) error {
+	eviction := &policyv1.Eviction{
+		ObjectMeta: metav1.ObjectMeta{Name: pod.Name, Namespace: pod.Namespace},
+	}
+	if gracePeriod >= 0 {
+		eviction.DeleteOptions = &metav1.DeleteOptions{GracePeriodSeconds: &gracePeriod}
+	}
+	return wait.PollUntilContextCancel(ctx, pollInterval, true, func(ctx context.Context) (bool, error) {
+		err := client.PolicyV1().Evictions(pod.Namespace).Evict(ctx, eviction)
+		switch {
+		case err == nil, apierrors.IsNotFound(err):
+			return true, nil
+		case apierrors.IsTooManyRequests(err):
+			log.Infof("eviction of pod %s/%s is blocked by PodDisruptionBudget, retrying", pod.Namespace, pod.Name)
+			return false, nil
+		}
+		return false, err
+	})
+}
+
+func evictable(pod corev1.Pod) bool {
+	if _, ok := pod.Annotations[mirrorPodAnnotation]; ok {
+		return false
+	}
+	if pod.Status.Phase == corev1.PodSucceeded || pod.Status.Phase == corev1.PodFailed {
+		return false
+	}
+	if ref := controllerOf(pod); ref != nil && ref.Kind == "DaemonSet" {
+		return false
+	}
+	return true
+}
+
+// controllerOf pod的控制器，没有时返回nil
+func controllerOf(pod corev1.Pod) *metav1.OwnerReference {
+	for i, ref := range pod.OwnerReferences {
+		if ref.Controller != nil && *ref.Controller {
+			return &pod.OwnerReferences[i]
+		}
+	}
+	return nil
+}
+
+// WaitReady 等待节点的Ready状态为True，且状态是kubelet在since之后上报的。
+// kubelet重启后，apiserver上仍然保留重启前的Ready状态，直到节点控制器在宽限期后将其标记为Unknown
+func WaitReady(ctx context.Context, client kubernetes.Interface, name string, since time.Time, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	err := wait.PollUntilContextCancel(ctx, pollInterval, true, func(ctx context.Context) (bool, error) {
+		node, err := client.CoreV1().Nodes().Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			log.Infof("get node %s: %v", name, err)
+			return false, nil
+		}
+		for _, c := range node.Status.Conditions {
+			if c.Type == corev1.NodeReady {
+				return c.Status == corev1.ConditionTrue && c.LastHeartbeatTime.After(since), nil
+			}
+		}
+		return false, nil
+	})
+	if err != nil {
+		return fmt.Errorf("node %s is not ready after %s", name, timeout)
+	}
+	return nil
+}
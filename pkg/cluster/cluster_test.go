@@ -0,0 +1,163 @@
+package cluster
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	policyv1 "k8s.io/api/policy/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func init() {
+	pollInterval = 10 * time.Millisecond
+}
+
+func testNode() *corev1.Node {
+	return &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "node-1", Labels: map[string]string{corev1.LabelHostname: "host-1"}},
+		Status: corev1.NodeStatus{
+			Addresses:  []corev1.NodeAddress{{Type: corev1.NodeInternalIP, Address: "10.0.0.1"}},
+			Conditions: []corev1.NodeCondition{{Type: corev1.NodeReady, Status: corev1.ConditionTrue}},
+		},
+	}
+}
+
+func testPod(name string, mutate func(*corev1.Pod)) *corev1.Pod {
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default", UID: types.UID("uid-" + name)},
+		Spec:       corev1.PodSpec{NodeName: "node-1"},
+		Status:     corev1.PodStatus{Phase: corev1.PodRunning},
+	}
+	if mutate != nil {
+		mutate(pod)
+	}
+	return pod
+}
+
+// TestFindNode 验证按节点名称、hostname标签和节点地址查找节点
+func TestFindNode(t *testing.T) {
+	client := fake.NewSimpleClientset(testNode())
+	for _, candidates := range [][]string{{"node-1"}, {"host-1"}, {"unknown", "10.0.0.1"}} {
+		name, err := FindNode(context.Background(), client, candidates)
+		if err != nil || name != "node-1" {
+			t.Errorf("FindNode(%v) = %q, %v", candidates, name, err)
+		}
+	}
+	if _, err := FindNode(context.Background(), client, []string{"10.0.0.2"}); err == nil {
+		t.Error("expected error for unknown node")
+	}
+}
+
+// TestCordon 验证封锁和解除封锁节点
+func TestCordon(t *testing.T) {
+	client := fake.NewSimpleClientset(testNode())
+	ctx := context.Background()
+	for _, unschedulable := range []bool{true, false} {
+		if err := Cordon(ctx, client, "node-1", unschedulable); err != nil {
+			t.Fatal(err)
+		}
+		cordoned, err := IsCordoned(ctx, client, "node-1")
+		if err != nil || cordoned != unschedulable {
+			t.Errorf("IsCordoned() = %v, %v, want %v", cordoned, err, unschedulable)
+		}
+	}
+}
+
+// TestDrain 验证只驱逐普通pod，被PDB阻止时重试直到驱逐成功，
+// 不受控制器管理的pod只在指定Force时驱逐
+func TestDrain(t *testing.T) {
+	controller := true
+	client := fake.NewSimpleClientset(
+		testNode(),
+		testPod("app", func(p *corev1.Pod) {
+			p.OwnerReferences = []metav1.OwnerReference{{Kind: "ReplicaSet", Name: "app", Controller: &controller}}
+		}),
+		testPod("bare", nil),
+		testPod("ds", func(p *corev1.Pod) {
+			p.OwnerReferences = []metav1.OwnerReference{{Kind: "DaemonSet", Name: "ds", Controller: &controller}}
+		}),
+		testPod("static", func(p *corev1.Pod) {
+			p.Annotations = map[string]string{mirrorPodAnnotation: "hash"}
+		}),
+		testPod("done", func(p *corev1.Pod) { p.Status.Phase = corev1.PodSucceeded }),
+	)
+
+	attempts := map[string]int{}
+	client.PrependReactor("create", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		if action.GetSubresource() != "eviction" {
+			return false, nil, nil
+		}
+		eviction := action.(k8stesting.CreateAction).GetObject().(*policyv1.Eviction)
+		attempts[eviction.Name]++
+		// 第一次驱逐被PDB阻止
+		if attempts[eviction.Name] == 1 {
+			return true, nil, apierrors.NewTooManyRequests("Cannot evict pod as it would violate the pod's disruption budget.", 0)
+		}
+		err := client.Tracker().Delete(schema.GroupVersionResource{Version: "v1", Resource: "pods"}, eviction.Namespace, eviction.Name)
+		return true, nil, err
+	})
+
+	// 有不受控制器管理的pod时拒绝驱逐，且不驱逐任何pod
+	err := Drain(context.Background(), client, "node-1", DrainOptions{Timeout: 5 * time.Second, GracePeriodSeconds: -1})
+	if !errors.Is(err, ErrUnmanagedPods) {
+		t.Fatalf("Drain() without Force = %v, want ErrUnmanagedPods", err)
+	}
+	if len(attempts) != 0 {
+		t.Errorf("pods evicted without Force: %v", attempts)
+	}
+
+	err = Drain(context.Background(), client, "node-1", DrainOptions{Timeout: 5 * time.Second, GracePeriodSeconds: -1, Force: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"app", "bare"} {
+		if attempts[name] != 2 {
+			t.Errorf("pod %s evicted %d times, want 2", name, attempts[name])
+		}
+	}
+	for _, name := range []string{"ds", "static", "done"} {
+		if attempts[name] != 0 {
+			t.Errorf("pod %s should not be evicted", name)
+		}
+	}
+}
+
+// TestWaitReady 验证节点未Ready、或者Ready状态是重启前上报的时超时返回错误
+func TestWaitReady(t *testing.T) {
+	ctx := context.Background()
+	restarted := time.Now()
+	node := testNode()
+	node.Status.Conditions[0].Status = corev1.ConditionFalse
+	node.Status.Conditions[0].LastHeartbeatTime = metav1.NewTime(restarted.Add(time.Second))
+	client := fake.NewSimpleClientset(node)
+	if err := WaitReady(ctx, client, "node-1", restarted, 100*time.Millisecond); err == nil {
+		t.Error("expected timeout for a NotReady node")
+	}
+
+	// 重启前上报的Ready状态在节点控制器标记为Unknown之前仍然是True
+	node.Status.Conditions[0].Status = corev1.ConditionTrue
+	node.Status.Conditions[0].LastHeartbeatTime = metav1.NewTime(restarted.Add(-10 * time.Second))
+	if _, err := client.CoreV1().Nodes().UpdateStatus(ctx, node, metav1.UpdateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := WaitReady(ctx, client, "node-1", restarted, 100*time.Millisecond); err == nil {
+		t.Error("expected timeout for a stale Ready condition")
+	}
+
+	node.Status.Conditions[0].LastHeartbeatTime = metav1.NewTime(restarted.Add(time.Second))
+	if _, err := client.CoreV1().Nodes().UpdateStatus(ctx, node, metav1.UpdateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := WaitReady(ctx, client, "node-1", restarted, time.Second); err != nil {
+		t.Error(err)
+	}
+}
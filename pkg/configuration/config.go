@@ -11,6 +11,20 @@ import (
 type HostConfig struct {
 	// 主机列表
 	Hosts      []Host `json:"hosts" yaml:"hosts"`
+	// 全局的跳板机，节点未单独配置时通过它连接
+	ProxyJump *ProxyJump `json:"proxyJump" yaml:"proxyJump"`
+}
+
+// ProxyJump 跳板机，认证方式与节点相同
+type ProxyJump struct {
+	IP                   string `json:"ip" yaml:"ip"`
+	Port                 string `json:"port" yaml:"port"`
+	UserName             string `json:"username" yaml:"username"`
+	Password             string `json:"password" yaml:"password"`
+	PrivateKeyFile       string `json:"privateKeyFile" yaml:"privateKeyFile"`
+	PrivateKeyPassphrase string `json:"privateKeyPassphrase" yaml:"privateKeyPassphrase"`
+	SSHAgent             bool   `json:"sshAgent" yaml:"sshAgent"`
+	HostKeyFingerprint   string `json:"hostKeyFingerprint" yaml:"hostKeyFingerprint"`
 }
 
 type Host struct {
@@ -18,6 +32,28 @@ type Host struct {
 	UserName string   `json:"username" yaml:"username"`
 	Password string   `json:"password" yaml:"password"`
 	Port     string   `json:"port" yaml:"port"`
+	// 私钥文件及其密码，优先于密码认证
+	PrivateKeyFile       string `json:"privateKeyFile" yaml:"privateKeyFile"`
+	PrivateKeyPassphrase string `json:"privateKeyPassphrase" yaml:"privateKeyPassphrase"`
+	// 使用SSH_AUTH_SOCK指定的ssh-agent中的密钥
+	SSHAgent bool `json:"sshAgent" yaml:"sshAgent"`
+	// 固定的主机公钥指纹，例如SHA256:xxxx，配置后不再使用known_hosts校验
+	HostKeyFingerprint string `json:"hostKeyFingerprint" yaml:"hostKeyFingerprint"`
+	// sudo的密码，为空时使用登录密码
+	SudoPassword string `json:"sudoPassword" yaml:"sudoPassword"`
+	// 通过sudo切换到的用户，默认为root，与登录用户相同时不使用sudo
+	Become string `json:"become" yaml:"become"`
+	// 节点单独使用的跳板机，优先于全局配置
+	ProxyJump *ProxyJump `json:"proxyJump" yaml:"proxyJump"`
+	// 节点角色，master/control-plane/worker，用于控制转换顺序
+	Role     string   `json:"role" yaml:"role"`
+	// 滚动转换时的分组，同一组的节点在同一批次中转换
+	Group    string   `json:"group" yaml:"group"`
+}
+
+// IsControlPlane 是否为控制平面节点
+func (h Host) IsControlPlane() bool {
+	return h.Role == "master" || h.Role == "control-plane"
 }
 
 var Instance HostConfig
@@ -26,8 +62,8 @@ func (h *Host) Validate() (*Host, error) {
 	if h.UserName == "" {
 		return nil, fmt.Errorf("Host's user field is required ")
 	}
-	if h.Password == "" {
-		return nil, fmt.Errorf("At least one of the host's password and ssh key is provided ")
+	if !h.HasCredential() {
+		return nil, fmt.Errorf("At least one of the host's password, private key file and ssh agent is provided ")
 	}
 	if h.IP == "" {
 		return nil, fmt.Errorf("Host address is required ")
@@ -41,6 +77,19 @@ func (h *Host) Validate() (*Host, error) {
 	return h, nil
 }
 
+// Jump 连接节点使用的跳板机，没有时返回nil
+func (h Host) Jump() *ProxyJump {
+	if h.ProxyJump != nil {
+		return h.ProxyJump
+	}
+	return Instance.ProxyJump
+}
+
+// HasCredential 是否配置了密码、私钥或ssh-agent中的任意一种认证方式
+func (h Host) HasCredential() bool {
+	return h.Password != "" || h.PrivateKeyFile != "" || h.SSHAgent
+}
+
 func (h Host) Fields() (string, string, string, string) {
 	return h.UserName, h.Password, h.IP, h.Port
 }
@@ -3,9 +3,12 @@ package containerd
 import (
 	"context"
 	"errors"
+	"net/url"
 	"github.com/containerd/containerd"
+	"github.com/containerd/containerd/cio"
 	"github.com/containerd/containerd/containers"
 	"github.com/containerd/containerd/namespaces"
+	"github.com/containerd/containerd/oci"
 	"transform/utils"
 	"transform/utils/log"
 )
@@ -13,7 +16,27 @@ import (
 type ContainerdClient interface {
 	GetClient() *containerd.Client
 	ContainerExists(containerName string) (containers.Container, bool)
+	ContainerInspect(containerId string) (ContainerInfo, error)
+	ContainerFind(containerName string) (ContainerInfo, error)
+	ContainerRemove(containerId string) error
+	TaskStop(containerId string) error
+	ContainerCreate(info ContainerInfo) error
+	ContainerStart(containerId string) error
+	CopyFromImage(image, snapshotter, srcPath, destinationFile, sum string) error
+	CopyFromContainer(containerId, srcPath, destinationFile, sum string) error
+	Exec(containerId string, command []string) (ExecResult, error)
+}
 
+// ContainerInfo 容器的元数据及OCI运行时配置，足以重新创建同样的容器
+type ContainerInfo struct {
+	ID          string            `json:"id"`
+	Name        string            `json:"name"`
+	Image       string            `json:"image"`
+	Labels      map[string]string `json:"labels"`
+	Runtime     string            `json:"runtime"`
+	Snapshotter string            `json:"snapshotter"`
+	SnapshotKey string            `json:"snapshotKey"`
+	Spec        *oci.Spec         `json:"spec"`
 }
 
 
@@ -27,6 +50,7 @@ var (
 	containerdSock      = "unix:///var/run/containerd/containerd.sock"
 	containerdNamespace = "k8s.io"
 	containerdSockLinux = "/var/run/containerd/containerd.sock"
+	nerdctlLogURILabel  = "nerdctl/log-uri"
 )
 
 func NewContainedClient() (ContainerdClient, error) {
@@ -76,3 +100,87 @@ func (c *Client) ContainerExists(containerName string) (containers.Container, bo
 
 }
 
+func (c *Client) ContainerInspect(containerId string) (ContainerInfo, error) {
+	container, err := c.condClient.LoadContainer(c.ctx, containerId)
+	if err != nil {
+		return ContainerInfo{}, err
+	}
+	info, err := container.Info(c.ctx)
+	if err != nil {
+		return ContainerInfo{}, err
+	}
+	spec, err := container.Spec(c.ctx)
+	if err != nil {
+		return ContainerInfo{}, err
+	}
+	name := info.Labels[nerdctlNameLabel]
+	if name == "" {
+		name = info.ID
+	}
+	return ContainerInfo{
+		ID:          info.ID,
+		Name:        name,
+		Image:       info.Image,
+		Labels:      info.Labels,
+		Runtime:     info.Runtime.Name,
+		Snapshotter: info.Snapshotter,
+		SnapshotKey: info.SnapshotKey,
+		Spec:        spec,
+	}, nil
+}
+
+// ContainerCreate recreate a container with the same id, labels and spec,
+// the rootfs snapshot is prepared again from the image
+func (c *Client) ContainerCreate(info ContainerInfo) error {
+	image, err := c.condClient.GetImage(c.ctx, info.Image)
+	if err != nil {
+		return err
+	}
+	snapshotKey := info.SnapshotKey
+	if snapshotKey == "" {
+		snapshotKey = info.ID
+	}
+	opts := []containerd.NewContainerOpts{
+		containerd.WithImage(image),
+		containerd.WithSnapshotter(info.Snapshotter),
+	}
+	// 快照可能仍然存在（例如删除容器时没有清理快照），存在则直接复用
+	if _, err = c.condClient.SnapshotService(info.Snapshotter).Stat(c.ctx, snapshotKey); err == nil {
+		opts = append(opts, containerd.WithSnapshot(snapshotKey))
+	} else {
+		opts = append(opts, containerd.WithNewSnapshot(snapshotKey, image))
+	}
+	opts = append(opts,
+		containerd.WithRuntime(info.Runtime, nil),
+		containerd.WithSpec(info.Spec),
+		containerd.WithContainerLabels(info.Labels),
+	)
+	_, err = c.condClient.NewContainer(c.ctx, info.ID, opts...)
+	return err
+}
+
+// ContainerStart create and start the task of the container,
+// the log uri recorded by nerdctl is reused when present
+func (c *Client) ContainerStart(containerId string) error {
+	container, err := c.condClient.LoadContainer(c.ctx, containerId)
+	if err != nil {
+		return err
+	}
+	labels, err := container.Labels(c.ctx)
+	if err != nil {
+		return err
+	}
+	ioCreator := cio.NullIO
+	if logURI, ok := labels[nerdctlLogURILabel]; ok && logURI != "" {
+		u, err := url.Parse(logURI)
+		if err != nil {
+			return err
+		}
+		ioCreator = cio.LogURI(u)
+	}
+	task, err := container.NewTask(c.ctx, ioCreator)
+	if err != nil {
+		return err
+	}
+	return task.Start(c.ctx)
+}
@@ -0,0 +1,126 @@
+package containerd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+	"transform/utils"
+
+	"github.com/containerd/containerd"
+	"github.com/containerd/containerd/mount"
+	"github.com/containerd/continuity/fs"
+	"github.com/opencontainers/image-spec/identity"
+)
+
+// CopyFromImage 从镜像中复制文件到宿主机，以只读方式挂载镜像已解压的快照，符号链接在镜像内解析，
+// sum不为空时校验sha256
+func (c *Client) CopyFromImage(image, snapshotter, srcPath, destinationFile, sum string) error {
+	if snapshotter == "" {
+		snapshotter = containerd.DefaultSnapshotter
+	}
+	img, err := c.condClient.GetImage(c.ctx, image)
+	if err != nil {
+		return err
+	}
+	diffIDs, err := img.RootFS(c.ctx)
+	if err != nil {
+		return err
+	}
+	sn := c.condClient.SnapshotService(snapshotter)
+	key := fmt.Sprintf("transform-copy-%d", time.Now().UnixNano())
+	mounts, err := sn.View(c.ctx, key, identity.ChainID(diffIDs).String())
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = sn.Remove(c.ctx, key)
+	}()
+	return c.copyFromMounts(mounts, srcPath, destinationFile, sum)
+}
+
+// CopyFromContainer 从容器当前的rootfs中复制文件到宿主机，以只读方式再次挂载容器的快照，
+// sum不为空时校验sha256
+func (c *Client) CopyFromContainer(containerId, srcPath, destinationFile, sum string) error {
+	container, err := c.condClient.LoadContainer(c.ctx, containerId)
+	if err != nil {
+		return err
+	}
+	info, err := container.Info(c.ctx)
+	if err != nil {
+		return err
+	}
+	if info.SnapshotKey == "" {
+		return errors.New(fmt.Sprintf("container %s has no rootfs snapshot", containerId))
+	}
+	mounts, err := c.condClient.SnapshotService(info.Snapshotter).Mounts(c.ctx, info.SnapshotKey)
+	if err != nil {
+		return err
+	}
+	return c.copyFromMounts(readOnly(mounts), srcPath, destinationFile, sum)
+}
+
+// readOnly 将快照的挂载改为只读。overlay的upperdir正在被运行中的容器使用，不能再次作为upperdir挂载，
+// 改为最上层的lowerdir
+func readOnly(mounts []mount.Mount) []mount.Mount {
+	result := make([]mount.Mount, 0, len(mounts))
+	for _, m := range mounts {
+		if m.Type != "overlay" {
+			m.Options = append(append([]string{}, m.Options...), "ro")
+			result = append(result, m)
+			continue
+		}
+		var upper, lower string
+		options := []string{}
+		for _, o := range m.Options {
+			switch {
+			case strings.HasPrefix(o, "upperdir="):
+				upper = strings.TrimPrefix(o, "upperdir=")
+			case strings.HasPrefix(o, "lowerdir="):
+				lower = strings.TrimPrefix(o, "lowerdir=")
+			case strings.HasPrefix(o, "workdir="):
+			default:
+				options = append(options, o)
+			}
+		}
+		if upper != "" {
+			if lower == "" {
+				lower = upper
+			} else {
+				lower = upper + ":" + lower
+			}
+		}
+		if !strings.Contains(lower, ":") {
+			// overlay至少需要两层lowerdir，只有一层时直接绑定挂载
+			result = append(result, mount.Mount{Type: "bind", Source: lower, Options: []string{"rbind", "ro"}})
+			continue
+		}
+		m.Options = append(options, "lowerdir="+lower)
+		result = append(result, m)
+	}
+	return result
+}
+
+// copyFromMounts 临时挂载rootfs并复制其中的文件
+func (c *Client) copyFromMounts(mounts []mount.Mount, srcPath, destinationFile, sum string) error {
+	return mount.WithTempMount(c.ctx, mounts, func(root string) error {
+		file, err := fs.RootPath(root, srcPath)
+		if err != nil {
+			return err
+		}
+		fi, err := os.Stat(file)
+		if err != nil {
+			return err
+		}
+		if !fi.Mode().IsRegular() {
+			return errors.New(fmt.Sprintf("%s is not a regular file", srcPath))
+		}
+		f, err := os.Open(file)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		return utils.SaveFile(f, destinationFile, sum)
+	})
+}
@@ -0,0 +1,83 @@
+package containerd
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"syscall"
+	"time"
+
+	"github.com/containerd/containerd"
+	"github.com/containerd/containerd/cio"
+)
+
+// ExecResult 在容器中执行命令的结果
+type ExecResult struct {
+	StdOut   string
+	StdErr   string
+	ExitCode int
+}
+
+// execTimeout 在容器中执行命令的超时时间
+var execTimeout = time.Minute
+
+// Exec 在容器正在运行的task中执行命令，使用容器自身的用户、环境变量和工作目录
+func (c *Client) Exec(containerId string, command []string) (ExecResult, error) {
+	var result ExecResult
+	ctx, cancel := context.WithTimeout(c.ctx, execTimeout)
+	defer cancel()
+	container, err := c.condClient.LoadContainer(ctx, containerId)
+	if err != nil {
+		return result, err
+	}
+	spec, err := container.Spec(ctx)
+	if err != nil {
+		return result, err
+	}
+	if spec.Process == nil {
+		return result, fmt.Errorf("container %s has no process spec", containerId)
+	}
+	task, err := container.Task(ctx, nil)
+	if err != nil {
+		return result, err
+	}
+
+	process := *spec.Process
+	process.Args = command
+	process.Terminal = false
+	var stdout, stderr bytes.Buffer
+	execId := fmt.Sprintf("transform-exec-%d", time.Now().UnixNano())
+	p, err := task.Exec(ctx, execId, &process, cio.NewCreator(cio.WithStreams(nil, &stdout, &stderr)))
+	if err != nil {
+		return result, err
+	}
+	// 超时后仍然需要删除进程
+	defer func() {
+		_, _ = p.Delete(c.ctx, containerd.WithProcessKill)
+	}()
+	exited, err := p.Wait(ctx)
+	if err != nil {
+		return result, err
+	}
+	if err = p.Start(ctx); err != nil {
+		return result, err
+	}
+
+	var status containerd.ExitStatus
+	select {
+	case status = <-exited:
+	case <-ctx.Done():
+		_ = p.Kill(c.ctx, syscall.SIGKILL)
+		return result, fmt.Errorf("%v did not exit in %s", command, execTimeout)
+	}
+	code, _, err := status.Result()
+	if err != nil {
+		return result, err
+	}
+	// 等待输出复制完成
+	p.IO().Wait()
+	result.ExitCode = int(code)
+	result.StdOut = stdout.String()
+	result.StdErr = stderr.String()
+	return result, nil
+}
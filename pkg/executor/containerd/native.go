@@ -0,0 +1,156 @@
+package containerd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+	"transform/utils"
+	"transform/utils/log"
+
+	"github.com/containerd/containerd"
+	"github.com/containerd/containerd/errdefs"
+)
+
+// nerdctlNameLabel nerdctl记录容器名称的label
+const nerdctlNameLabel = "nerdctl/name"
+
+// nerdctlNames nerdctl保存容器名称占用的文件，删除容器后需要释放名称
+var nerdctlNames = "/var/lib/nerdctl/*/names/%s/%s"
+
+// taskStopTimeout 删除容器前等待task退出的时间
+const taskStopTimeout = 30 * time.Second
+
+// MountPoint 容器的挂载信息
+type MountPoint struct {
+	Type        string `json:"type"`
+	Source      string `json:"source"`
+	Destination string `json:"destination"`
+	RW          bool   `json:"rw"`
+}
+
+// Args 容器的启动参数，不包括可执行文件
+func (i *ContainerInfo) Args() []string {
+	if i.Spec == nil || i.Spec.Process == nil || len(i.Spec.Process.Args) == 0 {
+		return nil
+	}
+	return i.Spec.Process.Args[1:]
+}
+
+// Env 容器的环境变量
+func (i *ContainerInfo) Env() []string {
+	if i.Spec == nil || i.Spec.Process == nil {
+		return nil
+	}
+	return i.Spec.Process.Env
+}
+
+// Mounts OCI配置中的绑定挂载，其他类型的挂载（proc、tmpfs等）在宿主机上没有对应的路径
+func (i *ContainerInfo) Mounts() []MountPoint {
+	mounts := []MountPoint{}
+	if i.Spec == nil {
+		return mounts
+	}
+	for _, m := range i.Spec.Mounts {
+		if m.Type != "bind" && !utils.ContainsString(m.Options, "bind") && !utils.ContainsString(m.Options, "rbind") {
+			continue
+		}
+		mounts = append(mounts, MountPoint{
+			Type:        "bind",
+			Source:      m.Source,
+			Destination: m.Destination,
+			RW:          !utils.ContainsString(m.Options, "ro"),
+		})
+	}
+	return mounts
+}
+
+// ContainerFind 按容器ID或nerdctl设置的名称查找容器
+func (c *Client) ContainerFind(containerName string) (ContainerInfo, error) {
+	info, err := c.ContainerInspect(containerName)
+	if err == nil || !errdefs.IsNotFound(err) {
+		return info, err
+	}
+	list, err := c.condClient.Containers(c.ctx, fmt.Sprintf("labels.%q==%s", nerdctlNameLabel, containerName))
+	if err != nil {
+		return ContainerInfo{}, err
+	}
+	switch len(list) {
+	case 0:
+		return ContainerInfo{}, fmt.Errorf("container %s: %w", containerName, errdefs.ErrNotFound)
+	case 1:
+		return c.ContainerInspect(list[0].ID())
+	}
+	return ContainerInfo{}, errors.New(fmt.Sprintf("%d containers are named %s", len(list), containerName))
+}
+
+// TaskStop 停止并删除容器的task，先发送SIGTERM，超时后发送SIGKILL，容器没有task时直接返回
+func (c *Client) TaskStop(containerId string) error {
+	container, err := c.condClient.LoadContainer(c.ctx, containerId)
+	if err != nil {
+		return err
+	}
+	task, err := container.Task(c.ctx, nil)
+	if err != nil {
+		if errdefs.IsNotFound(err) {
+			return nil
+		}
+		return err
+	}
+	exited, err := task.Wait(c.ctx)
+	if err != nil {
+		return err
+	}
+	if err = task.Kill(c.ctx, syscall.SIGTERM); err != nil && !errdefs.IsNotFound(err) {
+		return err
+	}
+	select {
+	case <-exited:
+	case <-time.After(taskStopTimeout):
+		log.Debugf("task of container %s did not exit in %s, killing it", containerId, taskStopTimeout)
+		if err = task.Kill(c.ctx, syscall.SIGKILL, containerd.WithKillAll); err != nil && !errdefs.IsNotFound(err) {
+			return err
+		}
+		<-exited
+	}
+	_, err = task.Delete(c.ctx)
+	if err != nil && !errdefs.IsNotFound(err) {
+		return err
+	}
+	return nil
+}
+
+// ContainerRemove 停止容器的task，删除容器及其rootfs快照，并释放nerdctl占用的容器名称
+func (c *Client) ContainerRemove(containerId string) error {
+	container, err := c.condClient.LoadContainer(c.ctx, containerId)
+	if err != nil {
+		return err
+	}
+	labels, err := container.Labels(c.ctx)
+	if err != nil {
+		return err
+	}
+	if err = c.TaskStop(containerId); err != nil {
+		return err
+	}
+	if err = container.Delete(c.ctx, containerd.WithSnapshotCleanup); err != nil {
+		return err
+	}
+	if name := labels[nerdctlNameLabel]; name != "" {
+		releaseName(name, containerId)
+	}
+	return nil
+}
+
+// releaseName 删除nerdctl记录的容器名称，避免之后无法使用同样的名称创建容器
+func releaseName(name, containerId string) {
+	files, _ := filepath.Glob(fmt.Sprintf(nerdctlNames, containerdNamespace, name))
+	for _, f := range files {
+		if b, err := os.ReadFile(f); err == nil && strings.TrimSpace(string(b)) == containerId {
+			_ = os.Remove(f)
+		}
+	}
+}
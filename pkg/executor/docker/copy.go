@@ -0,0 +1,66 @@
+package docker
+
+import (
+	"archive/tar"
+	"errors"
+	"fmt"
+	"path"
+	"transform/utils"
+	"transform/utils/log"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+)
+
+// maxSymlinks 复制文件时最多跟随的符号链接数
+const maxSymlinks = 8
+
+// CopyFromContainer 将容器中的文件复制到宿主机，符号链接会在容器内解析，sum不为空时校验sha256
+func (c *Client) CopyFromContainer(containerId, srcPath, destinationFile, sum string) error {
+	for i := 0; i < maxSymlinks; i++ {
+		reader, _, err := c.Client.CopyFromContainer(c.ctx, containerId, srcPath)
+		if err != nil {
+			log.Debugf("copy %s from container %s error: %v", srcPath, containerId, err)
+			return err
+		}
+		header, r, err := utils.FindInTar(reader, path.Base(srcPath))
+		if err != nil {
+			_ = reader.Close()
+			return err
+		}
+		switch header.Typeflag {
+		case tar.TypeReg:
+			err = utils.SaveFile(r, destinationFile, sum)
+			_ = reader.Close()
+			return err
+		case tar.TypeSymlink:
+			_ = reader.Close()
+			if path.IsAbs(header.Linkname) {
+				srcPath = header.Linkname
+			} else {
+				srcPath = path.Join(path.Dir(srcPath), header.Linkname)
+			}
+		default:
+			_ = reader.Close()
+			return errors.New(fmt.Sprintf("%s in container %s is not a regular file", srcPath, containerId))
+		}
+	}
+	return errors.New(fmt.Sprintf("too many levels of symbolic links in container %s", containerId))
+}
+
+// CopyFromImage 从镜像中复制文件到宿主机，使用镜像创建一个不启动的临时容器，复制完成后删除
+func (c *Client) CopyFromImage(image, srcPath, destinationFile, sum string) error {
+	config := &container.Config{
+		Image:      image,
+		Entrypoint: []string{srcPath},
+	}
+	resp, err := c.Client.ContainerCreate(c.ctx, config, nil, nil, nil, "")
+	if err != nil {
+		log.Debugf("create container from image %s error: %v", image, err)
+		return err
+	}
+	defer func() {
+		_ = c.Client.ContainerRemove(c.ctx, resp.ID, types.ContainerRemoveOptions{Force: true})
+	}()
+	return c.CopyFromContainer(resp.ID, srcPath, destinationFile, sum)
+}
@@ -3,11 +3,13 @@ package docker
 import (
 	"context"
 	"errors"
+	"strings"
 	"transform/utils"
 	"transform/utils/log"
 
 	"github.com/docker/docker/api/types"
 	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/network"
 	dockerapi "github.com/docker/docker/client"
 )
 
@@ -16,7 +18,11 @@ type DockerClient interface {
 	ContainerStop(containerId string) error
 	ContainerRemove(containerId string) error
 	ContainerExists(containerName string) (types.ContainerJSON, bool)
+	ContainerCreate(info types.ContainerJSON) (string, error)
+	ContainerStart(containerId string) error
 	Exec(containerID string, command []string) (ExecResult, error)
+	CopyFromContainer(containerId, srcPath, destinationFile, sum string) error
+	CopyFromImage(image, srcPath, destinationFile, sum string) error
 }
 
 type Client struct {
@@ -87,4 +93,29 @@ func (c *Client) ContainerStop(containerId string) error {
 	return nil
 }
 
+// ContainerCreate recreate a container from the inspect info of the original one
+func (c *Client) ContainerCreate(info types.ContainerJSON) (string, error) {
+	if info.ContainerJSONBase == nil || info.Config == nil {
+		return "", errors.New("container inspect info is incomplete")
+	}
+	networkingConfig := &network.NetworkingConfig{}
+	if info.NetworkSettings != nil {
+		networkingConfig.EndpointsConfig = info.NetworkSettings.Networks
+	}
+	name := strings.TrimPrefix(info.Name, "/")
+	resp, err := c.Client.ContainerCreate(c.ctx, info.Config, info.HostConfig, networkingConfig, nil, name)
+	if err != nil {
+		log.Debugf("create container %s error: %v", name, err)
+		return "", err
+	}
+	return resp.ID, nil
+}
 
+func (c *Client) ContainerStart(containerId string) error {
+	// docker start
+	if err := c.Client.ContainerStart(c.ctx, containerId, types.ContainerStartOptions{}); err != nil {
+		log.Debugf("start container %s error: %v", containerId, err)
+		return err
+	}
+	return nil
+}
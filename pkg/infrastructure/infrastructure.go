@@ -6,8 +6,6 @@ import (
 	"transform/pkg/executor/containerd"
 	"transform/pkg/executor/docker"
 	"transform/pkg/global"
-	"transform/utils"
-	"transform/utils/log"
 )
 
 func IsDocker() bool {
@@ -31,10 +29,6 @@ func IsContainerd() bool {
 	if global.Containerd != nil {
 		flag, err := global.Containerd.GetClient().IsServing(context.Background())
 		if flag && err == nil {
-			if !utils.Exists(utils.NerdCtl) {
-				log.BKEFormat(log.WARN, "The /usr/bin/nerdctl tool was not found.")
-				return false
-			}
 			return true
 		}
 	}
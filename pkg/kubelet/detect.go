@@ -0,0 +1,182 @@
+package kubelet
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"transform/pkg/backup"
+	"transform/pkg/global"
+	"transform/pkg/infrastructure"
+	"transform/utils"
+	"transform/utils/log"
+)
+
+// supportedRuntimes 支持转换的容器运行时
+var supportedRuntimes = []string{"docker", "containerd"}
+
+// imageVersion 镜像tag中的kubernetes版本，例如kubelet:v1.21.13或kubelet:1.26.15-amd64
+var imageVersion = regexp.MustCompile(`^v?(\d+\.\d+\.\d+)`)
+
+// detectRuntime 检测节点上可用的运行时及kubelet容器所在的运行时，未指定--runtime时使用检测结果，
+// 指定的运行时与检测结果矛盾时返回错误。返回检测到的可用运行时
+func (op *Options) detectRuntime() ([]string, error) {
+	available := []string{}
+	if infrastructure.IsDocker() {
+		available = append(available, "docker")
+	}
+	if infrastructure.IsContainerd() {
+		available = append(available, "containerd")
+	}
+	owners := []string{}
+	for _, r := range available {
+		if containerIn(r) {
+			owners = append(owners, r)
+		}
+	}
+	runtime, err := chooseRuntime(op.Runtime, available, owners)
+	if err != nil {
+		return available, err
+	}
+	if op.Runtime == "" {
+		log.BKEFormat(log.INFO, fmt.Sprintf("detected runtime %s", runtime))
+	}
+	op.Runtime = runtime
+	return available, nil
+}
+
+// chooseRuntime 根据可用的运行时和运行着kubelet容器的运行时选择要转换的运行时
+func chooseRuntime(flag string, available, owners []string) (string, error) {
+	if flag != "" && !utils.ContainsString(supportedRuntimes, flag) {
+		return "", fmt.Errorf("unsupported runtime %q, supported: %s", flag, strings.Join(supportedRuntimes, ","))
+	}
+	if len(available) == 0 {
+		return "", errors.New("no container runtime is available on this node, neither docker nor containerd is serving")
+	}
+	if flag != "" {
+		if !utils.ContainsString(available, flag) {
+			return "", fmt.Errorf("runtime %q is not available on this node, detected: %s", flag, strings.Join(available, ","))
+		}
+		if len(owners) > 0 && !utils.ContainsString(owners, flag) {
+			return "", fmt.Errorf("--runtime is %s, but container %s runs in %s", flag, utils.KUBELET_NAME, strings.Join(owners, ","))
+		}
+		return flag, nil
+	}
+	switch {
+	case len(owners) == 1:
+		return owners[0], nil
+	case len(owners) > 1:
+		return "", fmt.Errorf("container %s is found in %s, please specify --runtime", utils.KUBELET_NAME, strings.Join(owners, " and "))
+	case len(available) == 1:
+		// kubelet容器已经停止，由唯一可用的运行时重新启动
+		return available[0], nil
+	}
+	return "", fmt.Errorf("container %s is not found in %s, please specify --runtime", utils.KUBELET_NAME, strings.Join(available, " or "))
+}
+
+// containerIn kubelet容器是否在运行时中
+func containerIn(runtime string) bool {
+	if runtime == "docker" {
+		_, ok := global.Docker.ContainerExists(utils.KUBELET_NAME)
+		return ok
+	}
+	_, err := global.Containerd.ContainerFind(utils.KUBELET_NAME)
+	return err == nil
+}
+
+// detectVersion 从kubelet容器中检测kubernetes版本，未指定--kubernetes-version时使用检测结果，
+// 指定的版本与检测结果不一致时返回错误
+func (op *Options) detectVersion(s *backup.Snapshot) error {
+	version, from, err := containerVersion(s)
+	if err != nil {
+		// 从容器或镜像中复制kubelet时，版本取自复制的kubelet
+		if kind := op.sourceKind(); op.KubeVersion != "" || kind == SourceImage || kind == SourceContainer {
+			log.BKEFormat(log.WARN, fmt.Sprintf("failed to detect the kubernetes version: %v", err))
+			return nil
+		}
+		return fmt.Errorf("failed to detect the kubernetes version, please specify --kubernetes-version: %v", err)
+	}
+	if op.KubeVersion == "" {
+		op.KubeVersion = version
+		log.BKEFormat(log.INFO, fmt.Sprintf("detected kubernetes version %s from %s", version, from))
+		return nil
+	}
+	if !sameVersion(version, op.KubeVersion) {
+		return fmt.Errorf("--kubernetes-version is %s, but %s is %s", op.KubeVersion, from, version)
+	}
+	return nil
+}
+
+// containerVersion 优先在容器中执行kubelet --version，失败时使用镜像的tag，返回不带v前缀的版本及其来源
+func containerVersion(s *backup.Snapshot) (string, string, error) {
+	version, execErr := execVersion(s)
+	if execErr == nil {
+		return strings.TrimPrefix(version, "v"), fmt.Sprintf("kubelet in container %s", s.Container), nil
+	}
+	log.Debugf("kubelet --version in container %s error: %v", s.Container, execErr)
+	if version, ok := versionFromImage(s.Image()); ok {
+		return version, fmt.Sprintf("image %s", s.Image()), nil
+	}
+	return "", "", fmt.Errorf("%v, and image %q has no version tag", execErr, s.Image())
+}
+
+// execVersion 在容器中执行kubelet --version获取版本，不在节点上写入任何文件
+func execVersion(s *backup.Snapshot) (string, error) {
+	var err error
+	for _, p := range kubeletPaths(specOf(s).command) {
+		var version string
+		if s.Docker != nil && s.Docker.ContainerJSONBase != nil {
+			version, err = dockerVersion(s.Docker.ID, p)
+		} else if s.Containerd != nil {
+			version, err = containerdVersion(s.Containerd.ID, p)
+		} else {
+			return "", fmt.Errorf("container %s not found", s.Container)
+		}
+		if err == nil {
+			return version, nil
+		}
+	}
+	return "", err
+}
+
+func dockerVersion(id, binary string) (string, error) {
+	result, err := global.Docker.Exec(id, []string{binary, "--version"})
+	if err != nil {
+		return "", err
+	}
+	return versionOutput(binary, result.ExitCode, result.StdOut, result.StdErr)
+}
+
+func containerdVersion(id, binary string) (string, error) {
+	result, err := global.Containerd.Exec(id, []string{binary, "--version"})
+	if err != nil {
+		return "", err
+	}
+	return versionOutput(binary, result.ExitCode, result.StdOut, result.StdErr)
+}
+
+// versionOutput 从kubelet --version的输出中取出版本，例如Kubernetes v1.21.13
+func versionOutput(binary string, exitCode int, stdout, stderr string) (string, error) {
+	if exitCode != 0 {
+		return "", fmt.Errorf("%s --version exit code %d: %s", binary, exitCode, strings.TrimSpace(stderr))
+	}
+	fields := strings.Fields(stdout)
+	if len(fields) == 0 {
+		return "", fmt.Errorf("unexpected output of %s --version: %q", binary, stdout)
+	}
+	return fields[len(fields)-1], nil
+}
+
+// versionFromImage 从镜像的tag中取出版本
+func versionFromImage(image string) (string, bool) {
+	image = strings.SplitN(image, "@", 2)[0]
+	i := strings.LastIndex(image, ":")
+	if i < 0 || strings.Contains(image[i:], "/") {
+		return "", false
+	}
+	m := imageVersion.FindStringSubmatch(image[i+1:])
+	if m == nil {
+		return "", false
+	}
+	return m[1], true
+}
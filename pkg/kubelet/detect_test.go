@@ -0,0 +1,63 @@
+package kubelet
+
+import "testing"
+
+func TestChooseRuntime(t *testing.T) {
+	tests := []struct {
+		flag      string
+		available []string
+		owners    []string
+		want      string
+		wantErr   bool
+	}{
+		{"", []string{"docker", "containerd"}, []string{"containerd"}, "containerd", false},
+		{"", []string{"docker"}, nil, "docker", false},
+		{"", []string{"docker", "containerd"}, []string{"docker", "containerd"}, "", true},
+		{"", []string{"docker", "containerd"}, nil, "", true},
+		{"", nil, nil, "", true},
+		{"docker", []string{"docker", "containerd"}, []string{"docker"}, "docker", false},
+		{"docker", []string{"docker", "containerd"}, nil, "docker", false},
+		// 指定的运行时与kubelet容器所在的运行时矛盾
+		{"docker", []string{"docker", "containerd"}, []string{"containerd"}, "", true},
+		{"docker", []string{"containerd"}, []string{"containerd"}, "", true},
+		{"cri-o", []string{"containerd"}, []string{"containerd"}, "", true},
+	}
+	for _, tt := range tests {
+		got, err := chooseRuntime(tt.flag, tt.available, tt.owners)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("chooseRuntime(%q, %v, %v) = %q, %v, want %q", tt.flag, tt.available, tt.owners, got, err, tt.want)
+		}
+	}
+}
+
+func TestVersionFromImage(t *testing.T) {
+	tests := []struct {
+		image string
+		want  string
+		ok    bool
+	}{
+		{"registry.k8s.io/kubelet:v1.21.13", "1.21.13", true},
+		{"deploy.bocloud.k8s:40443/kubernetes/kubelet:1.26.15-amd64", "1.26.15", true},
+		{"kubelet:v1.21.13@sha256:0123", "1.21.13", true},
+		{"deploy.bocloud.k8s:40443/kubernetes/kubelet", "", false},
+		{"kubelet:latest", "", false},
+	}
+	for _, tt := range tests {
+		got, ok := versionFromImage(tt.image)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("versionFromImage(%q) = %q, %v, want %q, %v", tt.image, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestVersionOutput(t *testing.T) {
+	if got, err := versionOutput("/usr/bin/kubelet", 0, "Kubernetes v1.21.13\n", ""); err != nil || got != "v1.21.13" {
+		t.Errorf("versionOutput() = %q, %v", got, err)
+	}
+	if _, err := versionOutput("/usr/bin/kubelet", 127, "", "exec: not found"); err == nil {
+		t.Error("versionOutput() with exit code 127 succeeded")
+	}
+	if _, err := versionOutput("/usr/bin/kubelet", 0, "\n", ""); err == nil {
+		t.Error("versionOutput() with empty output succeeded")
+	}
+}
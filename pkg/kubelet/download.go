@@ -0,0 +1,178 @@
+package kubelet
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/ed25519"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"time"
+	"transform/pkg/backup"
+	"transform/utils"
+	"transform/utils/log"
+
+	"golang.org/x/crypto/blake2b"
+)
+
+const (
+	// sumsFile 仓库中各文件的sha256，格式与sha256sum的输出一致
+	sumsFile = "SHA256SUMS"
+	// sigSuffix SHA256SUMS的minisign签名文件后缀
+	sigSuffix = ".minisig"
+)
+
+// fetchKubelet 从选择的来源获取kubelet到/usr/bin下的临时文件，校验通过后才返回，失败时不修改节点
+func (op *Options) fetchKubelet(s *backup.Snapshot) (string, error) {
+	src, err := op.artifactSource(s)
+	if err != nil {
+		return "", err
+	}
+	staged := path.Join(path.Dir(utils.KubeletBinary), "."+path.Base(utils.KubeletBinary)+".new")
+	if err = src.Fetch(staged); err != nil {
+		return "", err
+	}
+	if err = os.Chmod(staged, 0755); err != nil {
+		_ = os.Remove(staged)
+		return "", err
+	}
+	// 未指定版本时使用获取到的kubelet的版本，指定了版本时在修改节点前确认版本一致
+	version, err := kubeletVersion(staged)
+	if err != nil {
+		_ = os.Remove(staged)
+		return "", err
+	}
+	if op.KubeVersion == "" {
+		op.KubeVersion = strings.TrimPrefix(version, "v")
+	} else if !sameVersion(version, op.KubeVersion) {
+		_ = os.Remove(staged)
+		return "", fmt.Errorf("kubelet from %s is %s, but --kubernetes-version is %s", src.Location(), version, op.KubeVersion)
+	}
+	log.Infof("fetch kubelet %s from %s success", version, src.Location())
+	return staged, nil
+}
+
+// installKubelet 将校验过的kubelet重命名为/usr/bin/kubelet
+func installKubelet(staged string) error {
+	if err := os.Rename(staged, utils.KubeletBinary); err != nil {
+		return err
+	}
+	// 同步目录，保证重命名落盘
+	if dir, err := os.Open(path.Dir(utils.KubeletBinary)); err == nil {
+		_ = dir.Sync()
+		_ = dir.Close()
+	}
+	return nil
+}
+
+// checksums 下载并解析SHA256SUMS，配置了公钥时先校验签名
+func (h *httpSource) checksums() (map[string]string, error) {
+	url := h.sumsURL()
+	data, err := httpGet(url)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download %s: %v", url, err)
+	}
+	if h.publicKey != "" {
+		key, err := parsePublicKey(h.publicKey)
+		if err != nil {
+			return nil, err
+		}
+		sig, err := httpGet(url + sigSuffix)
+		if err != nil {
+			return nil, fmt.Errorf("failed to download %s: %v", url+sigSuffix, err)
+		}
+		if err = key.verify(data, sig); err != nil {
+			return nil, fmt.Errorf("signature of %s is invalid: %v", url, err)
+		}
+	}
+	return parseSums(data), nil
+}
+
+// parseSums 解析sha256sum格式的校验文件，文件名前的*表示二进制模式
+func parseSums(data []byte) map[string]string {
+	sums := map[string]string{}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 2 || len(fields[0]) != 64 {
+			continue
+		}
+		sums[strings.TrimPrefix(fields[1], "*")] = strings.ToLower(fields[0])
+	}
+	return sums
+}
+
+// minisignKey minisign的ed25519公钥
+type minisignKey struct {
+	id  []byte
+	key ed25519.PublicKey
+}
+
+// parsePublicKey 解析minisign公钥，可以是公钥文件的路径、公钥文件的内容或其中base64编码的一行
+func parsePublicKey(s string) (*minisignKey, error) {
+	if b, err := os.ReadFile(s); err == nil {
+		s = string(b)
+	}
+	lines := strings.Split(strings.TrimSpace(s), "\n")
+	encoded := strings.TrimSpace(lines[len(lines)-1])
+	b, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil || len(b) != 2+8+ed25519.PublicKeySize || string(b[:2]) != "Ed" {
+		return nil, errors.New("invalid minisign public key")
+	}
+	return &minisignKey{id: b[2:10], key: b[10:]}, nil
+}
+
+// verify 校验minisign签名：签名行覆盖文件内容，全局签名覆盖签名和可信注释
+func (k *minisignKey) verify(data, sig []byte) error {
+	lines := strings.Split(strings.TrimSpace(string(sig)), "\n")
+	if len(lines) < 4 || !strings.HasPrefix(lines[2], "trusted comment: ") {
+		return errors.New("invalid minisign signature file")
+	}
+	s, err := base64.StdEncoding.DecodeString(strings.TrimSpace(lines[1]))
+	if err != nil || len(s) != 2+8+ed25519.SignatureSize {
+		return errors.New("invalid minisign signature")
+	}
+	if !bytes.Equal(s[2:10], k.id) {
+		return errors.New("signed by another key")
+	}
+	message := data
+	switch string(s[:2]) {
+	case "Ed":
+	case "ED":
+		// 预先计算哈希的签名
+		h := blake2b.Sum512(data)
+		message = h[:]
+	default:
+		return errors.New("unsupported signature algorithm")
+	}
+	if !ed25519.Verify(k.key, message, s[10:]) {
+		return errors.New("signature verification failed")
+	}
+	global, err := base64.StdEncoding.DecodeString(strings.TrimSpace(lines[3]))
+	if err != nil {
+		return errors.New("invalid minisign global signature")
+	}
+	trusted := strings.TrimPrefix(strings.TrimRight(lines[2], "\r"), "trusted comment: ")
+	if !ed25519.Verify(k.key, append(append([]byte{}, s[10:]...), trusted...), global) {
+		return errors.New("trusted comment verification failed")
+	}
+	return nil
+}
+
+func httpGet(url string) ([]byte, error) {
+	client := http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("status code %d", resp.StatusCode)
+	}
+	return io.ReadAll(resp.Body)
+}
@@ -0,0 +1,125 @@
+package kubelet
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"testing"
+
+	"golang.org/x/crypto/blake2b"
+)
+
+// minisign 生成minisign格式的公钥和签名文件
+func minisign(t *testing.T, data []byte, prehash bool) (string, string) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := []byte{1, 2, 3, 4, 5, 6, 7, 8}
+	key := base64.StdEncoding.EncodeToString(append(append([]byte("Ed"), id...), pub...))
+
+	alg, message := "Ed", data
+	if prehash {
+		h := blake2b.Sum512(data)
+		alg, message = "ED", h[:]
+	}
+	sig := ed25519.Sign(priv, message)
+	trusted := "timestamp:1700000000\tfile:SHA256SUMS"
+	global := ed25519.Sign(priv, append(append([]byte{}, sig...), trusted...))
+	signature := fmt.Sprintf("untrusted comment: signature from minisign secret key\n%s\ntrusted comment: %s\n%s\n",
+		base64.StdEncoding.EncodeToString(append(append([]byte(alg), id...), sig...)),
+		trusted,
+		base64.StdEncoding.EncodeToString(global))
+	return "untrusted comment: minisign public key 0807060504030201\n" + key + "\n", signature
+}
+
+func TestParseSums(t *testing.T) {
+	sum := hex.EncodeToString(make([]byte, 32))
+	sums := parseSums([]byte(fmt.Sprintf("%s  kubelet-1.21.13-amd64\n%s *kubelet-1.21.13-arm64\ninvalid line\n", sum, sum)))
+	if len(sums) != 2 || sums["kubelet-1.21.13-amd64"] != sum || sums["kubelet-1.21.13-arm64"] != sum {
+		t.Errorf("parseSums() = %v", sums)
+	}
+}
+
+func TestMinisignVerify(t *testing.T) {
+	data := []byte("0000  kubelet-1.21.13-amd64\n")
+	for _, prehash := range []bool{false, true} {
+		pubFile, signature := minisign(t, data, prehash)
+		file := path.Join(t.TempDir(), "minisign.pub")
+		if err := os.WriteFile(file, []byte(pubFile), 0644); err != nil {
+			t.Fatal(err)
+		}
+		key, err := parsePublicKey(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = key.verify(data, []byte(signature)); err != nil {
+			t.Errorf("verify(prehash=%v) = %v", prehash, err)
+		}
+		if err = key.verify([]byte("tampered"), []byte(signature)); err == nil {
+			t.Errorf("verify(prehash=%v) of tampered data succeeded", prehash)
+		}
+	}
+
+	// 其他公钥签名的文件
+	_, signature := minisign(t, data, false)
+	other, _ := minisign(t, data, false)
+	key, err := parsePublicKey(other)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = key.verify(data, []byte(signature)); err == nil {
+		t.Error("verify() with another key succeeded")
+	}
+	if _, err = parsePublicKey("invalid"); err == nil {
+		t.Error("parsePublicKey(invalid) succeeded")
+	}
+}
+
+func TestChecksums(t *testing.T) {
+	binary := []byte("kubelet")
+	h := sha256.Sum256(binary)
+	sum := hex.EncodeToString(h[:])
+	sums := []byte(fmt.Sprintf("%s  kubelet-1.21.13-amd64\n", sum))
+	pub, signature := minisign(t, sums, false)
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/" + sumsFile:
+			_, _ = w.Write(sums)
+		case "/" + sumsFile + sigSuffix:
+			_, _ = w.Write([]byte(signature))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer s.Close()
+
+	src := &httpSource{url: s.URL + "/kubelet-1.21.13-amd64", publicKey: pub}
+	got, err := src.checksums()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got["kubelet-1.21.13-amd64"] != sum {
+		t.Errorf("checksums() = %v", got)
+	}
+
+	// 签名不匹配时不返回校验值
+	other, _ := minisign(t, sums, false)
+	src.publicKey = other
+	if _, err = src.checksums(); err == nil {
+		t.Error("checksums() with another key succeeded")
+	}
+
+	// 仓库中没有SHA256SUMS
+	src = &httpSource{url: s.URL + "/missing/kubelet-1.21.13-amd64"}
+	if _, err = src.checksums(); err == nil {
+		t.Error("checksums() without SHA256SUMS succeeded")
+	}
+}
@@ -0,0 +1,161 @@
+package kubelet
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// systemd在解析ExecStart=时会展开%说明符和$环境变量，并按空白、引号和反斜杠拆分参数，
+// 这里的转义保证写入unit的参数经systemd解析后与容器中的参数完全一致。
+
+// 不需要加引号的字符
+const safeChars = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789-_=+,./:@"
+
+// execStart 生成ExecStart=的值
+func execStart(binary string, args []string) string {
+	words := make([]string, 0, len(args)+1)
+	words = append(words, quoteExecArg(binary))
+	for _, arg := range args {
+		words = append(words, quoteExecArg(arg))
+	}
+	return strings.Join(words, " ")
+}
+
+// quoteExecArg 转义ExecStart=中的单个参数
+func quoteExecArg(arg string) string {
+	if arg == ";" {
+		return `\;`
+	}
+	return quote(arg, true)
+}
+
+// quoteEnv 转义Environment=中的一个KEY=VALUE赋值，Environment=不展开$变量
+func quoteEnv(env string) string {
+	return quote(env, false)
+}
+
+func quote(s string, dollar bool) string {
+	if s != "" && strings.Trim(s, safeChars) == "" {
+		return s
+	}
+	b := strings.Builder{}
+	b.WriteByte('"')
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch c {
+		case '\\', '"':
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		case '%':
+			b.WriteString("%%")
+		case '$':
+			if dollar {
+				b.WriteString("$$")
+			} else {
+				b.WriteByte(c)
+			}
+		case '\n':
+			b.WriteString(`\n`)
+		case '\t':
+			b.WriteString(`\t`)
+		case '\r':
+			b.WriteString(`\r`)
+		default:
+			if c < 0x20 || c == 0x7f {
+				fmt.Fprintf(&b, `\x%02x`, c)
+			} else {
+				b.WriteByte(c)
+			}
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
+
+// splitExecStart 按systemd的规则解析ExecStart=的值，用于校验生成的unit和对比变更
+func splitExecStart(line string) ([]string, error) {
+	words := []string{}
+	i := 0
+	for {
+		for i < len(line) && (line[i] == ' ' || line[i] == '\t') {
+			i++
+		}
+		if i >= len(line) {
+			return words, nil
+		}
+		if line[i:] == `\;` || strings.HasPrefix(line[i:], `\; `) {
+			words = append(words, ";")
+			i += 2
+			continue
+		}
+
+		word := strings.Builder{}
+		var quote byte
+		for ; i < len(line); i++ {
+			c := line[i]
+			if quote == 0 && (c == ' ' || c == '\t') {
+				break
+			}
+			switch {
+			case c == '%':
+				if i+1 >= len(line) || line[i+1] != '%' {
+					return nil, fmt.Errorf("unsupported specifier at %d: %q", i, line)
+				}
+				word.WriteByte('%')
+				i++
+			case c == '$':
+				if i+1 >= len(line) || line[i+1] != '$' {
+					return nil, fmt.Errorf("unexpected variable expansion at %d: %q", i, line)
+				}
+				word.WriteByte('$')
+				i++
+			case c == '\\':
+				if i+1 >= len(line) {
+					return nil, errors.New("trailing backslash")
+				}
+				i++
+				n, err := unescape(line[i:], &word)
+				if err != nil {
+					return nil, err
+				}
+				i += n - 1
+			case quote == 0 && (c == '"' || c == '\''):
+				quote = c
+			case quote != 0 && c == quote:
+				quote = 0
+			default:
+				word.WriteByte(c)
+			}
+		}
+		if quote != 0 {
+			return nil, fmt.Errorf("unterminated quote in %q", line)
+		}
+		words = append(words, word.String())
+	}
+}
+
+// unescape 处理反斜杠后的C风格转义，返回消耗的字符数
+func unescape(s string, word *strings.Builder) (int, error) {
+	switch s[0] {
+	case 'n':
+		word.WriteByte('\n')
+	case 't':
+		word.WriteByte('\t')
+	case 'r':
+		word.WriteByte('\r')
+	case 'x':
+		if len(s) < 3 {
+			return 0, fmt.Errorf("invalid escape \\%s", s)
+		}
+		var c byte
+		if _, err := fmt.Sscanf(s[1:3], "%02x", &c); err != nil {
+			return 0, fmt.Errorf("invalid escape \\%s", s[:3])
+		}
+		word.WriteByte(c)
+		return 3, nil
+	default:
+		word.WriteByte(s[0])
+	}
+	return 1, nil
+}
@@ -0,0 +1,194 @@
+package kubelet
+
+import (
+	"os"
+	"os/exec"
+	"path"
+	"reflect"
+	"strings"
+	"testing"
+	"transform/pkg/backup"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+)
+
+// 容器中常见的、含有空格、引号、逗号、JSON及systemd特殊字符的kubelet参数
+var roundTripArgs = []string{
+	"--config=/var/lib/kubelet/config.yaml",
+	"--feature-gates=RotateKubeletServerCertificate=true,CSIMigration=false",
+	`--node-labels=node-role.kubernetes.io/worker=,topology.kubernetes.io/zone="zone a"`,
+	"--eviction-hard=memory.available<100Mi,nodefs.available<10%,imagefs.available<15%",
+	`--kube-reserved={"cpu":"500m","memory":"1Gi"}`,
+	"--pod-infra-container-image=registry.local:5000/pause:3.9",
+	"--v", "2",
+	"--cluster-dns=10.96.0.10",
+	"--hostname-override=node 01",
+	"--register-with-taints=dedicated=gpu:NoSchedule",
+	"--system-reserved=cpu=200m,memory=$MEM",
+	"--log-dir=C:\\logs\\kubelet",
+	"--container-runtime-endpoint='unix:///run/containerd/containerd.sock'",
+	"--tls-cipher-suites=TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256;x",
+	"--provider-id=",
+	"",
+	";",
+	"line1\nline2\tTab",
+}
+
+// TestExecStartRoundTrip 转义后的ExecStart经systemd规则解析，应与原参数完全一致
+func TestExecStartRoundTrip(t *testing.T) {
+	line := execStart("/usr/bin/kubelet", roundTripArgs)
+	words, err := splitExecStart(line)
+	if err != nil {
+		t.Fatalf("split %q: %v", line, err)
+	}
+	want := append([]string{"/usr/bin/kubelet"}, roundTripArgs...)
+	if !reflect.DeepEqual(words, want) {
+		t.Errorf("round trip mismatch\n line: %s\n got:  %q\n want: %q", line, words, want)
+	}
+}
+
+// TestQuoteExecArg 每个参数单独转义后再解析
+func TestQuoteExecArg(t *testing.T) {
+	for _, arg := range roundTripArgs {
+		quoted := quoteExecArg(arg)
+		words, err := splitExecStart(quoted)
+		if err != nil {
+			t.Errorf("split %q: %v", quoted, err)
+			continue
+		}
+		if len(words) != 1 || words[0] != arg {
+			t.Errorf("quoteExecArg(%q) = %s, parsed back as %q", arg, quoted, words)
+		}
+	}
+}
+
+// TestSplitExecStart 解析手写的ExecStart
+func TestSplitExecStart(t *testing.T) {
+	tests := []struct {
+		line string
+		want []string
+		err  bool
+	}{
+		{line: `/usr/bin/kubelet --v=2`, want: []string{"/usr/bin/kubelet", "--v=2"}},
+		{line: `/usr/bin/kubelet "--a=b c" 'd e'`, want: []string{"/usr/bin/kubelet", "--a=b c", "d e"}},
+		{line: `/usr/bin/kubelet --x=10%% $$HOME`, want: []string{"/usr/bin/kubelet", "--x=10%", "$HOME"}},
+		{line: `/usr/bin/kubelet "--a=\"q\""`, want: []string{"/usr/bin/kubelet", `--a="q"`}},
+		{line: `/usr/bin/kubelet %n`, err: true},
+		{line: `/usr/bin/kubelet $KUBELET_ARGS`, err: true},
+		{line: `/usr/bin/kubelet "unterminated`, err: true},
+	}
+	for _, tt := range tests {
+		words, err := splitExecStart(tt.line)
+		if tt.err {
+			if err == nil {
+				t.Errorf("split %q: expected error, got %q", tt.line, words)
+			}
+			continue
+		}
+		if err != nil || !reflect.DeepEqual(words, tt.want) {
+			t.Errorf("split %q = %q, %v, want %q", tt.line, words, err, tt.want)
+		}
+	}
+}
+
+// TestRenderedUnitRoundTrip 从容器信息生成unit文件，解析其中的ExecStart应得到容器的参数
+func TestRenderedUnitRoundTrip(t *testing.T) {
+	info := types.ContainerJSON{
+		ContainerJSONBase: &types.ContainerJSONBase{
+			Path:       "kubelet",
+			Args:       roundTripArgs,
+			HostConfig: &container.HostConfig{},
+		},
+		Config: &container.Config{},
+	}
+	u, _ := translate(&backup.Snapshot{Docker: &info})
+	content, err := u.render()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var line string
+	for _, l := range strings.Split(content, "\n") {
+		if strings.HasPrefix(l, "ExecStart=") {
+			line = strings.TrimPrefix(l, "ExecStart=")
+		}
+	}
+	words, err := splitExecStart(line)
+	if err != nil {
+		t.Fatalf("split %q: %v", line, err)
+	}
+	if !reflect.DeepEqual(words[1:], roundTripArgs) {
+		t.Errorf("unit args mismatch\n got:  %q\n want: %q", words[1:], roundTripArgs)
+	}
+}
+
+// TestQuoteGolden 按systemd.service(5)和systemd.exec(5)的规则手写的转义结果：
+// %需要写成%%，ExecStart=中的$需要写成$$，引号内的反斜杠和双引号需要转义，单独的;需要写成\;
+func TestQuoteGolden(t *testing.T) {
+	execTests := []struct{ arg, want string }{
+		{"--v=2", "--v=2"},
+		{"", `""`},
+		{";", `\;`},
+		{"--eviction-hard=nodefs.available<10%", `"--eviction-hard=nodefs.available<10%%"`},
+		{"--node-ip=%H", `"--node-ip=%%H"`},
+		{"--system-reserved=memory=$MEM", `"--system-reserved=memory=$$MEM"`},
+		{"${HOME}", `"$${HOME}"`},
+		{`--log-dir=C:\logs`, `"--log-dir=C:\\logs"`},
+		{`--labels=zone="a b"`, `"--labels=zone=\"a b\""`},
+		{"--endpoint='unix:///run/containerd.sock'", `"--endpoint='unix:///run/containerd.sock'"`},
+		{"a;b", `"a;b"`},
+		{"line1\nline2\tx", `"line1\nline2\tx"`},
+		{"bell\a", `"bell\x07"`},
+	}
+	for _, tt := range execTests {
+		if got := quoteExecArg(tt.arg); got != tt.want {
+			t.Errorf("quoteExecArg(%q) = %s, want %s", tt.arg, got, tt.want)
+		}
+	}
+
+	// Environment=展开%说明符但不展开$变量
+	envTests := []struct{ env, want string }{
+		{"HTTP_PROXY=http://proxy:3128", "HTTP_PROXY=http://proxy:3128"},
+		{"NO_PROXY=10.0.0.0/8 .local", `"NO_PROXY=10.0.0.0/8 .local"`},
+		{"RATIO=10%", `"RATIO=10%%"`},
+		{"ARGS=--a=$B", `"ARGS=--a=$B"`},
+		{`MSG=say "hi"`, `"MSG=say \"hi\""`},
+	}
+	for _, tt := range envTests {
+		if got := quoteEnv(tt.env); got != tt.want {
+			t.Errorf("quoteEnv(%q) = %s, want %s", tt.env, got, tt.want)
+		}
+	}
+}
+
+// TestSystemdAnalyzeVerify 使用systemd-analyze verify校验生成的unit文件，没有systemd-analyze时跳过
+func TestSystemdAnalyzeVerify(t *testing.T) {
+	analyze, err := exec.LookPath("systemd-analyze")
+	if err != nil {
+		t.Skip("systemd-analyze not found")
+	}
+	binary, err := exec.LookPath("true")
+	if err != nil {
+		t.Skip("true not found")
+	}
+	u := &unit{
+		ExecStart:   execStart(binary, roundTripArgs),
+		Environment: []string{quoteEnv("HTTP_PROXY=http://proxy:3128"), quoteEnv("ARGS=--a=$B 10%"), quoteEnv(`MSG=say "hi"`)},
+		LimitNOFILE: "infinity",
+		LimitNPROC:  "infinity",
+		LimitCORE:   "infinity",
+	}
+	content, err := u.render()
+	if err != nil {
+		t.Fatal(err)
+	}
+	file := path.Join(t.TempDir(), "kubelet.service")
+	if err = os.WriteFile(file, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// 引号、转义不合法时systemd忽略该行并输出警告，退出码不一定非0
+	out, err := exec.Command(analyze, "verify", "--man=no", file).CombinedOutput()
+	if err != nil || len(out) > 0 {
+		t.Errorf("systemd-analyze verify: %v\n%s\n%s", err, out, content)
+	}
+}
@@ -1,27 +1,60 @@
 package kubelet
 
 import (
+	"errors"
 	"fmt"
 	"os"
-	"runtime"
+	"path"
 	"strings"
 	"time"
-	"transform/pkg/executor/containerd"
+	"transform/pkg/backup"
 	"transform/pkg/global"
-	"transform/pkg/infrastructure"
+	"transform/pkg/report"
 	"transform/pkg/root"
 	"transform/utils"
 	"transform/utils/log"
+
+	"gopkg.in/yaml.v3"
+	"k8s.io/client-go/kubernetes"
 )
 
 type Options struct {
 	root.Options
 	Args []string `json:"args"`
-	
+
 	HttpRepo string `json:"httpRepo"`
+	// kubelet二进制文件的来源，<类型>[=<地址>]，默认从HttpRepo下载
+	ArtifactSource string `json:"artifactSource"`
+	// 从正在运行的kubelet容器中复制kubelet，不需要HttpRepo和KubeVersion
+	FromImage bool `json:"fromImage"`
 	KubeVersion string `json:"kubeVersion"`
 	Runtime string `json:"runtime"`
 	Timeout int64 `json:"timeout"`
+	ResultDir string `json:"resultDir"`
+	// 回滚使用的备份名称，为空时使用最近一次的备份
+	Snapshot string `json:"snapshot"`
+	DryRun bool `json:"dryRun"`
+	// 转换前封锁节点，转换完成且节点Ready后解除封锁
+	Cordon bool `json:"cordon"`
+	// 转换前驱逐节点上的pod，包含Cordon
+	Drain bool `json:"drain"`
+	DrainTimeout int64 `json:"drainTimeout"`
+	// 驱逐时同时删除不受控制器管理的pod
+	DrainForce bool `json:"drainForce"`
+	// kubernetes中的节点名称，为空时按主机名和IP地址查找
+	NodeName string `json:"nodeName"`
+	// 校验SHA256SUMS签名的minisign公钥，可以是公钥文件路径或base64编码的公钥
+	PublicKey string `json:"publicKey"`
+	// 不校验获取的kubelet，仅用于没有SHA256SUMS的仓库或本地文件
+	InsecureSkipVerify bool `json:"insecureSkipVerify"`
+
+	client kubernetes.Interface
+	// 本次转换封锁了节点，转换前已经封锁的节点不解除封锁
+	cordoned bool
+	// 停止容器kubelet的时间，此后上报的节点状态才来自systemd启动的kubelet
+	stoppedAt time.Time
+	// 转换后的检查结果
+	checks []report.CaseInfo
 }
 
 var kubeletService = `
@@ -32,7 +65,16 @@ After=containerd.service network.target local-fs.target
 
 
 [Service]
-ExecStart=/usr/bin/kubelet %s
+{{- range .Environment}}
+Environment={{.}}
+{{- end}}
+{{- if .User}}
+User={{.User}}
+{{- end}}
+ExecStart={{.ExecStart}}
+{{- range .Resources}}
+{{.}}
+{{- end}}
 
 Restart=always
 StartLimitInterval=0
@@ -40,9 +82,9 @@ RestartSec=10
 
 # Having non-zero Limit*s causes performance problems due to accounting overhead
 # in the kernel. We recommend using cgroups to do container-local accounting.
-LimitNPROC=infinity
-LimitCORE=infinity
-LimitNOFILE=infinity
+LimitNPROC={{.LimitNPROC}}
+LimitCORE={{.LimitCORE}}
+LimitNOFILE={{.LimitNOFILE}}
 # Comment TasksMax if your systemd version does not supports it.
 # Only systemd 226 and above support this version.
 #TasksMax=infinity
@@ -51,332 +93,305 @@ OOMScoreAdjust=-999
 [Install]
 WantedBy=multi-user.target
 `
-var fileName = "/etc/systemd/system/kubelet.service"
+var fileName = utils.KubeletServiceFile
 var kubeletName  = "kubelet-%s-%s"
 
-func (op *Options) Resetbak() {
-	if infrastructure.IsDocker() {
-		log.BKEFormat(log.INFO, "current runtime is docker")
-		//获取kubelet运行参数
-		kubeletInfo, _ := global.Docker.ContainerExists(utils.KUBELET_NAME)
-
-		//创建kubelet.service文件
-		// 创建文件
-		file, err := os.Create(fileName)
-		defer file.Close()
-		if err != nil {
-			log.BKEFormat(log.ERROR, err.Error())
-			return
-		}
-
-		args := strings.Join(kubeletInfo.Args, " ")
-		content := fmt.Sprintf(fileName, args)
-		content = strings.ReplaceAll(content, `"`, "")
-
-		_, err = file.WriteString(content)
-		if err != nil {
-			log.BKEFormat(log.ERROR, err.Error())
-			return
-		}
+const (
+	errorFile  = "error.log"
+	resultFile = "result.yaml"
+	// snapshotNameFile 本次转换前备份的名称，失败时主控节点按它回滚
+	snapshotNameFile = "snapshot"
+	// modifiedFile 节点上的文件或容器已被修改，没有它说明转换在修改节点前失败，不需要回滚
+	modifiedFile = "modified"
+)
 
-		//停止容器kubelet
-		err = global.Docker.ContainerStop(utils.KUBELET_NAME)
-
-		//运行kubelet.service
-		name := fmt.Sprintf(kubeletName, op.KubeVersion, runtime.GOARCH)
-		utils.DownloadFile(op.HttpRepo+name, "/usr/bin/kubelet")
-		err = global.Command.ExecuteCommand("chmod", "+x", "/usr/bin/kubelet")
-		err = global.Command.ExecuteCommand("systemctl ", "enable", "kubelet", "--now")
-		result, err := global.Command.ExecuteCommandWithCombinedOutput("systemctl", "restart", "kubelet")
-		if err != nil {
-			log.BKEFormat(log.ERROR, result)
-			return
+func (op *Options) Reset() error {
+	if _, err := op.detectRuntime(); err != nil {
+		return err
+	}
+	log.BKEFormat(log.INFO, fmt.Sprintf("current runtime is %s", op.Runtime))
+
+	//获取kubelet运行参数
+	if !op.containerExists() {
+		//重新启动kubelet
+		op.startContainer()
+		time.Sleep(5*time.Second)
+		if !op.containerExists() {
+			return errors.New("no found kubelet container")
 		}
-		log.BKEFormat(log.INFO, result)
-
+	}
 
-		log.BKEFormat(log.INFO, "completed")
-		return
+	//修改节点前先备份kubelet容器及原有文件，用于失败后回滚
+	snapshot, err := backup.Take(op.Runtime, utils.KUBELET_NAME)
+	if err != nil {
+		return fmt.Errorf("failed to snapshot kubelet: %v", err)
+	}
+	op.writeMarker(snapshotNameFile, snapshot.Name)
+	log.Info(snapshot.Args())
+	if err = op.detectVersion(snapshot); err != nil {
+		return err
 	}
-	if infrastructure.IsContainerd() {
-		log.BKEFormat(log.INFO, "current runtime is containerd")
-		//获取kubelet运行参数
-		kubeletInfo, ok := containerd.ContainerExists(utils.KUBELET_NAME)
-		if !ok {
-			log.Error("no found kubelet container")
-			return
-		}
 
-		//创建kubelet.service文件
-		// 创建文件
-		file, err := os.Create(fileName)
-		defer file.Close()
-		if err != nil {
-			log.BKEFormat(log.ERROR, err.Error())
-			return
-		}
+	//下载并校验kubelet，校验失败时不修改节点
+	staged, err := op.fetchKubelet(snapshot)
+	if err != nil {
+		return fmt.Errorf("failed to download kubelet: %v", err)
+	}
+	defer os.Remove(staged)
 
-		args := strings.Join(kubeletInfo.Args, " ")
-		content := fmt.Sprintf(fileName, args)
-		content = strings.ReplaceAll(content, `"`, "")
+	//生成kubelet.service的内容，修改节点前确认可以生成并解析
+	content, warnings, err := renderUnit(snapshot)
+	if err != nil {
+		return err
+	}
+	for _, warning := range warnings {
+		log.BKEFormat(log.WARN, warning)
+	}
+	v, err := newVerifier(op, content)
+	if err != nil {
+		return err
+	}
 
-		_, err = file.WriteString(content)
-		if err != nil {
-			log.BKEFormat(log.ERROR, err.Error())
-			return
-		}
+	//封锁节点，按需驱逐pod
+	if err = op.cordonNode(); err != nil {
+		op.warnCordoned()
+		return err
+	}
+	v.recordPods()
+
+	//创建kubelet.service文件，先写入临时文件再重命名，失败时原有文件保持不变
+	op.writeMarker(modifiedFile, time.Now().Format(time.RFC3339))
+	if err = utils.SaveFile(strings.NewReader(content), fileName, ""); err != nil {
+		log.Error(err)
+		op.warnCordoned()
+		return fmt.Errorf("failed to write %s: %v", fileName, err)
+	}
+	log.Infof("create %s success", fileName)
+
+	//停止容器kubelet
+	op.stoppedAt = time.Now()
+	if err = op.removeContainer(); err != nil {
+		log.Error(err)
+		//重新启动kubelet
+		op.startContainer()
+		op.warnCordoned()
+		return err
+	}
+	log.Info("remove kubelet success")
+
+	//安装校验过的kubelet
+	if err = installKubelet(staged); err != nil {
+		log.Error(err)
+		op.startContainer()
+		op.warnCordoned()
+		return err
+	}
+	log.Infof("install %s success", utils.KubeletBinary)
 
-		//停止容器kubelet
-		err = global.Docker.ContainerStop(utils.KUBELET_NAME)
-
-		//运行kubelet.service
-		name := fmt.Sprintf(kubeletName, op.KubeVersion, runtime.GOARCH)
-		utils.DownloadFile(op.HttpRepo+name, "/usr/bin/kubelet")
-		err = global.Command.ExecuteCommand("chmod", "+x", "/usr/bin/kubelet")
-		err = global.Command.ExecuteCommand("systemctl ", "enable", "kubelet", "--now")
-		result, err := global.Command.ExecuteCommandWithCombinedOutput("systemctl", "restart", "kubelet")
-		if err != nil {
-			log.BKEFormat(log.ERROR, result)
-			return
-		}
-		log.BKEFormat(log.INFO, result)
+	if err = op.waitForRunning(v); err != nil {
+		op.warnCordoned()
+		return err
+	}
+	if err = op.uncordonNode(); err != nil {
+		op.warnCordoned()
+		return err
+	}
+	log.BKEFormat(log.INFO, "completed")
+	return nil
+}
 
+// Rollback 使用指定的备份恢复容器化的kubelet，未指定时使用最近一次的备份
+func (op *Options) Rollback() error {
+	var snapshot *backup.Snapshot
+	var err error
+	if op.Snapshot != "" {
+		snapshot, err = backup.Load(op.Snapshot)
+	} else {
+		snapshot, err = backup.Latest()
+	}
+	if err != nil {
+		return err
+	}
+	if err = snapshot.Restore(); err != nil {
+		return err
+	}
+	log.BKEFormat(log.INFO, fmt.Sprintf("kubelet restored from snapshot %s", snapshot.Name))
+	return nil
+}
 
-		log.BKEFormat(log.INFO, "completed")
+// WriteResult 批量执行时，将节点的执行结果写入结果目录，供主控节点收集。
+// 失败时同时写入error.log，结果中保留转换后已经执行的检查
+func (op *Options) WriteResult(startTime time.Time, er error) {
+	if op.ResultDir == "" {
 		return
 	}
+	detail := fmt.Sprintf("kubelet %s is running as systemd service", op.KubeVersion)
+	if er != nil {
+		_ = os.WriteFile(path.Join(op.ResultDir, errorFile), []byte(er.Error()), 0644)
+		detail = er.Error()
+	}
+	op.writeReport(startTime, "kubelet转换", detail, er, op.checks, nil)
 }
-func (op *Options) Reset() {
-	if op.Runtime == "docker" && infrastructure.IsDocker(){
-		log.BKEFormat(log.INFO, "current runtime is docker")
-		//获取kubelet运行参数
-		kubeletInfo, ok := global.Docker.ContainerExists(utils.KUBELET_NAME)
-		if !ok {
-			//重新启动kubelet
-			err := global.Command.ExecuteCommand("bash", "/etc/kubernetes/kubelet.sh", "-a", "start", "-r", op.Runtime)
-			if err != nil {
-				log.Error(err)
-			}
-			log.Info("restart kubelet")
-			time.Sleep(5*time.Second)
-			kubeletInfo, _ = global.Docker.ContainerExists(utils.KUBELET_NAME)
-		}
-		log.Info(kubeletInfo.Args)
-
-		//创建kubelet.service文件
-		// 创建文件
-		// 打开文件，如果文件存在则清空它的内容
-		file, err := os.OpenFile(fileName, os.O_WRONLY|os.O_TRUNC|os.O_CREATE, 0644)
-		if err != nil {
-			log.Fatalf("Failed to open file: %s", err)
-			return
-		}
-		defer file.Close()
-		log.Infof("create %s success", fileName)
 
+// writeMarker 批量执行时，在结果目录中记录转换的进度，供主控节点决定是否回滚
+func (op *Options) writeMarker(name, content string) {
+	if op.ResultDir == "" {
+		return
+	}
+	if err := os.WriteFile(path.Join(op.ResultDir, name), []byte(content+"\n"), 0644); err != nil {
+		log.Error(err)
+	}
+}
 
-		args := strings.Join(kubeletInfo.Args, " ")
-		content := fmt.Sprintf(kubeletService, args)
-		content = strings.ReplaceAll(content, `"`, "")
+// WritePlan 批量生成转换计划时，将节点的计划写入结果目录，供主控节点收集
+func (op *Options) WritePlan(startTime time.Time, p *Plan, er error) {
+	if op.ResultDir == "" {
+		return
+	}
+	if er != nil {
+		_ = os.WriteFile(path.Join(op.ResultDir, errorFile), []byte(er.Error()), 0644)
+		return
+	}
+	op.writeReport(startTime, "转换计划", fmt.Sprintf("%d warnings", len(p.Warnings)), nil, nil, []report.PlanInfo{p.ReportInfo()})
+}
 
-		_, err = file.WriteString(content)
-		if err != nil {
-			log.Error(err)
-			return
+func (op *Options) writeReport(startTime time.Time, name, detail string, er error, checks []report.CaseInfo, plan []report.PlanInfo) {
+	ip, _ := utils.GetIntranetIp()
+	data := report.ReportData{
+		StartTime:    startTime.Format("2006-01-02 15:04:05"),
+		DurationTime: time.Now().Sub(startTime).String(),
+		Total:        1,
+		Success:      1,
+		Result:       report.PASS,
+		Case: []report.CaseInfo{
+			{
+				Identify:     "kubelet",
+				IP:           ip,
+				Role:         "kubelet转换",
+				Name:         name,
+				Status:       report.Success,
+				Detail:       detail,
+				DurationTime: time.Now().Sub(startTime).String(),
+			},
+		},
+		Plan: plan,
+	}
+	if er != nil {
+		data.Case[0].Status = report.Failure
+		data.Success = 0
+		data.Failure = 1
+		data.Result = report.NOTPASS
+	}
+	for _, c := range checks {
+		c.IP = ip
+		data.Case = append(data.Case, c)
+		data.Total++
+		switch c.Status {
+		case report.Success:
+			data.Success++
+		case report.Warning:
+			data.Warning++
+		default:
+			data.Failure++
+			data.Result = report.NOTPASS
 		}
+	}
+	b, err := yaml.Marshal(data)
+	if err != nil {
+		log.Error(err)
+		return
+	}
+	_ = os.WriteFile(path.Join(op.ResultDir, resultFile), b, 0644)
+}
 
-		//停止容器kubelet
-		err = global.Docker.ContainerRemove(utils.KUBELET_NAME)
-		if err != nil {
-			log.Error(err)
-			//重新启动kubelet
-			err = global.Command.ExecuteCommand("bash", "/etc/kubernetes/kubelet.sh", "-a", "start", "-r", op.Runtime)
-			if err != nil {
-				log.Error(err)
-			}
-			log.Info("restart kubelet")
-		}
-		log.Info("remove kubelet success")
+func (op *Options) containerExists() bool {
+	if op.Runtime == "docker" {
+		_, ok := global.Docker.ContainerExists(utils.KUBELET_NAME)
+		return ok
+	}
+	_, err := global.Containerd.ContainerFind(utils.KUBELET_NAME)
+	return err == nil
+}
 
-		//运行kubelet.service
-		name := fmt.Sprintf(kubeletName, op.KubeVersion, runtime.GOARCH)
-		err = utils.DownloadFile(op.HttpRepo+name, "/usr/bin/kubelet")
-		if err != nil {
-			log.Error(err)
-		}
-		log.Info("wget kubelet success")
+func (op *Options) removeContainer() error {
+	if op.Runtime == "docker" {
+		return global.Docker.ContainerRemove(utils.KUBELET_NAME)
+	}
+	info, err := global.Containerd.ContainerFind(utils.KUBELET_NAME)
+	if err != nil {
+		return err
+	}
+	return global.Containerd.ContainerRemove(info.ID)
+}
 
+func (op *Options) startContainer() {
+	err := global.Command.ExecuteCommand("bash", "/etc/kubernetes/kubelet.sh", "-a", "start", "-r", op.Runtime)
+	if err != nil {
+		log.Error(err)
+	}
+	log.Info("restart kubelet")
+}
 
-		err = global.Command.ExecuteCommand("chmod", "+x", "/usr/bin/kubelet")
-		if err != nil {
-			log.Error(err)
-		}
-retry_docker:
-		err = global.Command.ExecuteCommand("systemctl", "daemon-reload")
-		if err != nil {
-			log.Error(err)
-		}
-		log.Info("systemctl daemon-reload success")
+// restartService 重新加载并启动kubelet.service
+func restartService() {
+	err := global.Command.ExecuteCommand("systemctl", "daemon-reload")
+	if err != nil {
+		log.Error(err)
+	}
+	log.Info("systemctl daemon-reload success")
 
-		err = global.Command.ExecuteCommand("systemctl", "enable", "kubelet", "--now")
-		if err != nil {
-			log.Error(err)
-		}
-		log.Info("systemctl enable kubelet --now success")
+	err = global.Command.ExecuteCommand("systemctl", "enable", "kubelet", "--now")
+	if err != nil {
+		log.Error(err)
+	}
+	log.Info("systemctl enable kubelet --now success")
 
-		result, err := global.Command.ExecuteCommandWithCombinedOutput("systemctl", "restart", "kubelet")
-		if err != nil {
-			log.Error(err)
-		}
-		log.Info("systemctl restart kubelet", result)
+	result, err := global.Command.ExecuteCommandWithCombinedOutput("systemctl", "restart", "kubelet")
+	if err != nil {
+		log.Error(err)
+	}
+	log.Info("systemctl restart kubelet", result)
+}
 
-		result, err = global.Command.ExecuteCommandWithCombinedOutput("systemctl", "status", "kubelet")
-		if err != nil {
-			log.Error(err)
-		}
-		log.Info("systemctl status kubelet", result)
-
-		ticker := time.NewTicker(time.Second * 60)
-		defer ticker.Stop()
-		done := make(chan bool)
-		go func() {
-			time.Sleep(time.Minute * time.Duration(op.Timeout))
-			done <- true
-		}()
-
-		for {
-			select {
-			case <-done:
-				log.Error("timeout")
-				return
-			case <-ticker.C:
-				state, err := global.Command.ExecuteCommandWithCombinedOutput("systemctl", "status", "kubelet")
-				log.Infof(state, err)
-				if !strings.Contains(state, "running"){
-					log.Info("Retrying docker...")
-					goto retry_docker
-				}else {
-					log.Info("docker is running.")
-					return
+// waitForRunning 启动kubelet.service，并在超时时间内周期检查kubelet是否正常工作
+func (op *Options) waitForRunning(v *verifier) error {
+	restartService()
+
+	ticker := time.NewTicker(verifyInterval)
+	defer ticker.Stop()
+	timeout := time.After(time.Minute * time.Duration(op.Timeout))
+
+	for {
+		select {
+		case <-timeout:
+			failed := []string{}
+			for _, c := range op.checks {
+				if c.Status == report.Failure {
+					failed = append(failed, fmt.Sprintf("%s: %s", c.Name, c.Detail))
 				}
 			}
-		}
-
-		log.BKEFormat(log.INFO, "completed")
-		return
-	}
-	if op.Runtime == "containerd" && infrastructure.IsContainerd(){
-		log.BKEFormat(log.INFO, "current runtime is containerd")
-		//获取kubelet运行参数
-		kubeletInfo, ok := containerd.ContainerExists(utils.KUBELET_NAME)
-		if !ok {
-			//重新启动kubelet
-			err := global.Command.ExecuteCommand("bash", "/etc/kubernetes/kubelet.sh", "-a", "start", "-r", op.Runtime)
-			if err != nil {
-				log.Error(err)
+			if len(op.checks) == 0 {
+				failed = append(failed, "kubelet.service is not active")
 			}
-			log.Info("restart kubelet")
-			time.Sleep(5*time.Second)
-			kubeletInfo, _ = containerd.ContainerExists(utils.KUBELET_NAME)
-		}
-
-		log.Info(kubeletInfo.Args)
-
-		//创建kubelet.service文件
-		// 创建文件
-		// 打开文件，如果文件存在则清空它的内容
-		file, err := os.OpenFile(fileName, os.O_WRONLY|os.O_TRUNC|os.O_CREATE, 0644)
-		if err != nil {
-			log.Fatalf("Failed to open file: %s", err)
-			return
-		}
-		defer file.Close()
-		log.Infof("create %s success", fileName)
-
-
-		args := strings.Join(kubeletInfo.Args, " ")
-		content := fmt.Sprintf(kubeletService, args)
-		content = strings.ReplaceAll(content, `"`, "")
-
-		_, err = file.WriteString(content)
-		if err != nil {
-			log.Error(err)
-			return
-		}
-
-		//停止容器kubelet
-		err = containerd.ContainerRemove(utils.KUBELET_NAME)
-		if err != nil {
-			log.Error(err)
-		}
-		log.Info("remove kubelet success")
-
-		//运行kubelet.service
-		name := fmt.Sprintf(kubeletName, op.KubeVersion, runtime.GOARCH)
-		err = utils.DownloadFile(op.HttpRepo+name, "/usr/bin/kubelet")
-		if err != nil {
-			log.Error(err)
-		}
-		log.Info("wget kubelet success")
-
-
-		err = global.Command.ExecuteCommand("chmod", "+x", "/usr/bin/kubelet")
-		if err != nil {
-			log.Error(err)
-		}
-retry_containerd:
-		err = global.Command.ExecuteCommand("systemctl", "daemon-reload")
-		if err != nil {
-			log.Error(err)
-		}
-		log.Info("systemctl daemon-reload success")
-
-		err = global.Command.ExecuteCommand("systemctl", "enable", "kubelet", "--now")
-		if err != nil {
-			log.Error(err)
-		}
-		log.Info("systemctl enable kubelet --now success")
-
-		result, err := global.Command.ExecuteCommandWithCombinedOutput("systemctl", "restart", "kubelet")
-		if err != nil {
-			log.Error(err)
-		}
-		log.Info("systemctl restart kubelet", result)
-
-		result, err = global.Command.ExecuteCommandWithCombinedOutput("systemctl", "status", "kubelet")
-		if err != nil {
-			log.Error(err)
-		}
-		log.Info("systemctl status kubelet", result)
-
-		ticker := time.NewTicker(time.Second * 60)
-		defer ticker.Stop()
-		done := make(chan bool)
-		go func() {
-			time.Sleep(time.Minute * time.Duration(op.Timeout))
-			done <- true
-		}()
-
-		for {
-			select {
-			case <-done:
-				log.Error("timeout")
-				return
-			case <-ticker.C:
-				state, err := global.Command.ExecuteCommandWithCombinedOutput("systemctl", "status", "kubelet")
-				log.Infof(state, err)
-				if !strings.Contains(state, "running"){
-					log.Info("Retrying containerd...")
-					goto retry_containerd
-				}else {
-					log.Info("Container is running.")
-					return
+			return fmt.Errorf("kubelet is not healthy after %d minutes:\n%s", op.Timeout, strings.Join(failed, "\n"))
+		case <-ticker.C:
+			state, _ := global.Command.ExecuteCommandWithOutput("systemctl", "is-active", "kubelet")
+			if strings.TrimSpace(state) != "active" {
+				log.Infof("kubelet.service is %s, retrying...", strings.TrimSpace(state))
+				restartService()
+				continue
+			}
+			op.checks = v.verify()
+			if !passed(op.checks) {
+				for _, c := range op.checks {
+					if c.Status == report.Failure {
+						log.Infof("%s: %s", c.Name, c.Detail)
+					}
 				}
+				continue
 			}
+			log.Info("kubelet is running and healthy.")
+			return nil
 		}
-
-
-		log.BKEFormat(log.INFO, "completed")
-		return
 	}
-}
\ No newline at end of file
+}
@@ -0,0 +1,45 @@
+package kubelet
+
+import (
+	"errors"
+	"os"
+	"path"
+	"testing"
+	"time"
+	"transform/pkg/report"
+
+	"gopkg.in/yaml.v3"
+)
+
+// TestWriteResult 验证转换失败时结果中仍然包含已经执行的检查，并同时写入error.log
+func TestWriteResult(t *testing.T) {
+	dir := t.TempDir()
+	op := &Options{
+		ResultDir:   dir,
+		KubeVersion: "1.21.13",
+		checks: []report.CaseInfo{
+			{Name: "kubelet healthz", Status: report.Failure, Detail: "connection refused"},
+			{Name: "kubelet版本", Status: report.Success},
+		},
+	}
+	op.WriteResult(time.Now(), errors.New("kubelet is not healthy after 2 minutes"))
+
+	b, err := os.ReadFile(path.Join(dir, errorFile))
+	if err != nil || string(b) != "kubelet is not healthy after 2 minutes" {
+		t.Errorf("error.log = %q, %v", b, err)
+	}
+	b, err = os.ReadFile(path.Join(dir, resultFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := report.ReportData{}
+	if err = yaml.Unmarshal(b, &data); err != nil {
+		t.Fatal(err)
+	}
+	if data.Result != report.NOTPASS || data.Total != 3 || data.Success != 1 || data.Failure != 2 {
+		t.Errorf("result = %s, total %d, success %d, failure %d", data.Result, data.Total, data.Success, data.Failure)
+	}
+	if len(data.Case) != 3 || data.Case[0].Status != report.Failure || data.Case[1].Name != "kubelet healthz" {
+		t.Errorf("cases = %+v", data.Case)
+	}
+}
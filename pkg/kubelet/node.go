@@ -0,0 +1,122 @@
+package kubelet
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"time"
+	"transform/pkg/cluster"
+	"transform/utils/log"
+)
+
+// 等待节点Ready的超时时间
+var nodeReadyTimeout = 5 * time.Minute
+
+// cordonEnabled 是否需要在转换前后封锁节点
+func (op *Options) cordonEnabled() bool {
+	return op.Cordon || op.Drain
+}
+
+// cordonNode 转换前封锁节点，开启--drain时驱逐节点上的pod
+func (op *Options) cordonNode() error {
+	if !op.cordonEnabled() {
+		return nil
+	}
+	if op.KubeConfig == "" {
+		return errors.New("--kubeconfig is required to cordon or drain the node")
+	}
+	ctx := context.Background()
+	if op.client == nil {
+		client, err := cluster.NewClient(op.KubeConfig)
+		if err != nil {
+			return err
+		}
+		op.client = client
+	}
+	if op.NodeName == "" {
+		name, err := cluster.FindNode(ctx, op.client, localNames())
+		if err != nil {
+			return err
+		}
+		op.NodeName = name
+	}
+
+	// 转换前已经被封锁的节点由运维人员管理，转换后保持封锁
+	cordoned, err := cluster.IsCordoned(ctx, op.client, op.NodeName)
+	if err != nil {
+		return fmt.Errorf("failed to get node %s: %v", op.NodeName, err)
+	}
+	if cordoned {
+		log.BKEFormat(log.INFO, fmt.Sprintf("node %s is already cordoned and will stay cordoned after the conversion", op.NodeName))
+	} else {
+		if err = cluster.Cordon(ctx, op.client, op.NodeName, true); err != nil {
+			return fmt.Errorf("failed to cordon node %s: %v", op.NodeName, err)
+		}
+		op.cordoned = true
+		log.BKEFormat(log.INFO, fmt.Sprintf("node %s cordoned", op.NodeName))
+	}
+	if !op.Drain {
+		return nil
+	}
+	err = cluster.Drain(ctx, op.client, op.NodeName, cluster.DrainOptions{
+		Timeout:            time.Duration(op.DrainTimeout) * time.Minute,
+		GracePeriodSeconds: -1,
+		Force:              op.DrainForce,
+	})
+	if errors.Is(err, cluster.ErrUnmanagedPods) {
+		return fmt.Errorf("failed to drain node %s: %v, use --drain-force to delete them", op.NodeName, err)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to drain node %s: %v", op.NodeName, err)
+	}
+	log.BKEFormat(log.INFO, fmt.Sprintf("node %s drained", op.NodeName))
+	return nil
+}
+
+// uncordonNode 等待systemd启动的kubelet将节点上报为Ready后，解除本次转换设置的封锁
+func (op *Options) uncordonNode() error {
+	if !op.cordonEnabled() || op.client == nil {
+		return nil
+	}
+	ctx := context.Background()
+	if err := cluster.WaitReady(ctx, op.client, op.NodeName, op.stoppedAt, nodeReadyTimeout); err != nil {
+		return err
+	}
+	if !op.cordoned {
+		log.BKEFormat(log.INFO, fmt.Sprintf("node %s is ready and left cordoned as it was before the conversion", op.NodeName))
+		return nil
+	}
+	if err := cluster.Cordon(ctx, op.client, op.NodeName, false); err != nil {
+		return fmt.Errorf("failed to uncordon node %s: %v", op.NodeName, err)
+	}
+	op.cordoned = false
+	log.BKEFormat(log.INFO, fmt.Sprintf("node %s is ready and uncordoned", op.NodeName))
+	return nil
+}
+
+// warnCordoned 转换失败时本次封锁的节点保持封锁状态，提示回滚后手动解除
+func (op *Options) warnCordoned() {
+	if op.cordoned {
+		log.BKEFormat(log.WARN, fmt.Sprintf("node %s is left cordoned, run `kubectl uncordon %s` after it is recovered", op.NodeName, op.NodeName))
+	}
+}
+
+// localNames 本机的主机名和所有IPv4地址，用于查找对应的节点
+func localNames() []string {
+	names := []string{}
+	if hostname, err := os.Hostname(); err == nil {
+		names = append(names, hostname)
+	}
+	addresses, err := net.InterfaceAddrs()
+	if err != nil {
+		return names
+	}
+	for _, address := range addresses {
+		if ipNet, ok := address.(*net.IPNet); ok && !ipNet.IP.IsLoopback() && ipNet.IP.To4() != nil {
+			names = append(names, ipNet.IP.String())
+		}
+	}
+	return names
+}
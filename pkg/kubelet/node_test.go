@@ -0,0 +1,44 @@
+package kubelet
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// TestCordonNode 验证只解除本次转换设置的封锁，转换前已经封锁的节点保持封锁
+func TestCordonNode(t *testing.T) {
+	for _, before := range []bool{false, true} {
+		node := &corev1.Node{
+			ObjectMeta: metav1.ObjectMeta{Name: "node-1"},
+			Spec:       corev1.NodeSpec{Unschedulable: before},
+			Status: corev1.NodeStatus{
+				Conditions: []corev1.NodeCondition{{Type: corev1.NodeReady, Status: corev1.ConditionTrue, LastHeartbeatTime: metav1.Now()}},
+			},
+		}
+		client := fake.NewSimpleClientset(node)
+		op := &Options{Cordon: true, NodeName: "node-1", client: client}
+		op.KubeConfig = "kubeconfig"
+		op.stoppedAt = time.Now().Add(-time.Minute)
+		if err := op.cordonNode(); err != nil {
+			t.Fatal(err)
+		}
+		if op.cordoned == before {
+			t.Errorf("cordoned = %v when the node was unschedulable=%v", op.cordoned, before)
+		}
+		if err := op.uncordonNode(); err != nil {
+			t.Fatal(err)
+		}
+		got, err := client.CoreV1().Nodes().Get(context.Background(), "node-1", metav1.GetOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.Spec.Unschedulable != before {
+			t.Errorf("unschedulable = %v after the conversion, want %v", got.Spec.Unschedulable, before)
+		}
+	}
+}
@@ -0,0 +1,166 @@
+package kubelet
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+	"transform/pkg/backup"
+	"transform/pkg/report"
+	"transform/utils"
+	"transform/utils/log"
+)
+
+// Plan 转换将要对节点做的变更，只读取节点状态，不修改任何内容
+type Plan struct {
+	Runtime          string   `json:"runtime" yaml:"runtime"`
+	DetectedRuntimes []string `json:"detectedRuntimes" yaml:"detectedRuntimes"`
+	Container        string   `json:"container" yaml:"container"`
+	Image            string   `json:"image" yaml:"image"`
+	Version          string   `json:"version" yaml:"version"`
+	DownloadURL      string   `json:"downloadURL" yaml:"downloadURL"`
+	DownloadStatus   string   `json:"downloadStatus" yaml:"downloadStatus"`
+	UnitFile         string   `json:"unitFile" yaml:"unitFile"`
+	Unit             string   `json:"unit" yaml:"unit"`
+	Diff             string   `json:"diff" yaml:"diff"`
+	Steps            []string `json:"steps" yaml:"steps"`
+	Warnings         []string `json:"warnings" yaml:"warnings"`
+}
+
+// Plan 检测运行时，读取kubelet容器，生成将要写入的unit文件及与当前文件的差异
+func (op *Options) Plan() (*Plan, error) {
+	p := &Plan{
+		Runtime:   op.Runtime,
+		Container: utils.KUBELET_NAME,
+		UnitFile:  fileName,
+	}
+	var err error
+	p.DetectedRuntimes, err = op.detectRuntime()
+	if err != nil {
+		return p, err
+	}
+	p.Runtime = op.Runtime
+
+	snapshot, err := backup.Inspect(op.Runtime, utils.KUBELET_NAME)
+	if err != nil {
+		return p, fmt.Errorf("failed to inspect kubelet container: %v", err)
+	}
+	p.Image = snapshot.Image()
+	if err = op.detectVersion(snapshot); err != nil {
+		return p, err
+	}
+	p.Version = op.KubeVersion
+
+	p.Unit, p.Warnings, err = renderUnit(snapshot)
+	if err != nil {
+		return p, err
+	}
+	current, err := os.ReadFile(fileName)
+	if err != nil && !os.IsNotExist(err) {
+		return p, err
+	}
+	p.Diff = utils.Diff(fileName, fileName+" (planned)", string(current), p.Unit)
+
+	src, err := op.artifactSource(snapshot)
+	if err != nil {
+		return p, err
+	}
+	p.DownloadURL = src.Location()
+	p.DownloadStatus = src.Check()
+
+	p.Steps = []string{
+		fmt.Sprintf("save snapshot of container %s under %s", utils.KUBELET_NAME, backup.Dir()),
+		src.Describe(),
+	}
+	if op.cordonEnabled() {
+		p.Steps = append(p.Steps, fmt.Sprintf("cordon node %s", op.nodeDescription()))
+	}
+	if op.Drain {
+		p.Steps = append(p.Steps, fmt.Sprintf("drain node %s, respecting PodDisruptionBudgets", op.nodeDescription()))
+	}
+	p.Steps = append(p.Steps,
+		fmt.Sprintf("write %s", fileName),
+		fmt.Sprintf("remove %s container %s", op.Runtime, utils.KUBELET_NAME),
+		fmt.Sprintf("install the verified kubelet to %s", utils.KubeletBinary),
+		"systemctl daemon-reload && systemctl enable kubelet --now",
+		"verify kubelet healthz, process, version, static pods and running pods",
+	)
+	if op.cordonEnabled() {
+		p.Steps = append(p.Steps, fmt.Sprintf("wait for node %s to be Ready and uncordon it", op.nodeDescription()))
+	}
+	return p, nil
+}
+
+// Print 以可读的格式输出转换计划
+func (p *Plan) Print() {
+	log.BKEFormat(log.NIL, fmt.Sprintf("runtime: %s (detected: %s)", p.Runtime, strings.Join(p.DetectedRuntimes, ",")))
+	log.BKEFormat(log.NIL, fmt.Sprintf("container: %s, image: %s, version: %s", p.Container, p.Image, p.Version))
+	log.BKEFormat(log.NIL, fmt.Sprintf("kubelet binary: %s (%s)", p.DownloadURL, p.DownloadStatus))
+	for _, warning := range p.Warnings {
+		log.BKEFormat(log.WARN, warning)
+	}
+	log.BKEFormat(log.NIL, "planned steps:")
+	for i, step := range p.Steps {
+		fmt.Printf("  %d. %s\n", i+1, step)
+	}
+	log.BKEFormat(log.NIL, fmt.Sprintf("planned %s:", p.UnitFile))
+	fmt.Println(p.Unit)
+	if p.Diff == "" {
+		log.BKEFormat(log.NIL, fmt.Sprintf("%s is unchanged", p.UnitFile))
+		return
+	}
+	log.BKEFormat(log.NIL, "diff:")
+	fmt.Print(p.Diff)
+}
+
+// ReportInfo 转换为报告中的计划
+func (p *Plan) ReportInfo() report.PlanInfo {
+	ip, _ := utils.GetIntranetIp()
+	return report.PlanInfo{
+		IP:               ip,
+		Runtime:          p.Runtime,
+		DetectedRuntimes: p.DetectedRuntimes,
+		Image:            p.Image,
+		Version:          p.Version,
+		DownloadURL:      p.DownloadURL,
+		DownloadStatus:   p.DownloadStatus,
+		UnitFile:         p.UnitFile,
+		Unit:             p.Unit,
+		Diff:             p.Diff,
+		Steps:            p.Steps,
+		Warnings:         p.Warnings,
+	}
+}
+
+// nodeDescription 计划中显示的节点名称
+func (op *Options) nodeDescription() string {
+	if op.NodeName != "" {
+		return op.NodeName
+	}
+	return "matching " + strings.Join(localNames(), ",")
+}
+
+// renderUnit 根据容器信息生成kubelet.service的内容
+func renderUnit(s *backup.Snapshot) (string, []string, error) {
+	u, warnings := translate(s)
+	content, err := u.render()
+	return content, warnings, err
+}
+
+// checkURL 检查文件是否可以下载
+func checkURL(url string) string {
+	if url == "" {
+		return "unknown"
+	}
+	client := http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Head(url)
+	if err != nil {
+		return err.Error()
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return resp.Status
+	}
+	return "available"
+}
@@ -0,0 +1,428 @@
+package kubelet
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"runtime"
+	"strings"
+	"transform/pkg/backup"
+	"transform/pkg/global"
+	"transform/utils"
+	"transform/utils/log"
+)
+
+// kubelet二进制文件的来源
+const (
+	// SourceHTTP 仓库中平铺的kubelet-<version>-<arch>，使用仓库中的SHA256SUMS校验
+	SourceHTTP = "http"
+	// SourceRelease 与dl.k8s.io相同的目录结构release/v<version>/bin/linux/<arch>/kubelet，使用同目录的kubelet.sha256校验
+	SourceRelease = "release"
+	// SourceLocal 节点上的kubelet二进制文件、kubernetes-node-linux-<arch>.tar.gz或包含它们的目录
+	SourceLocal = "local"
+	// SourceImage 从kubelet容器使用的镜像中复制kubelet
+	SourceImage = "image"
+	// SourceContainer 从正在运行的kubelet容器中复制kubelet，版本与转换前完全一致，由--from-image选择
+	SourceContainer = "container"
+)
+
+const (
+	defaultReleaseURL = "https://dl.k8s.io/release/"
+	nodeTarball       = "kubernetes-node-linux-%s.tar.gz"
+	// tarballKubelet kubernetes-node-linux-<arch>.tar.gz中kubelet的路径
+	tarballKubelet = "kubernetes/node/bin/kubelet"
+)
+
+// 镜像中kubelet的常见位置，容器启动命令中没有kubelet的绝对路径时依次尝试
+var imageKubeletPaths = []string{"/usr/local/bin/kubelet", "/usr/bin/kubelet", "/kubelet", "/bin/kubelet"}
+
+// ArtifactSource kubelet二进制文件的来源
+type ArtifactSource interface {
+	// Location 来源的地址，显示在计划和报告中
+	Location() string
+	// Check 只检查来源是否可用，不下载文件
+	Check() string
+	// Describe 计划中获取和校验kubelet的步骤
+	Describe() string
+	// Fetch 获取并校验kubelet，写入destinationFile，失败时destinationFile保持不变
+	Fetch(destinationFile string) error
+}
+
+// artifactSource 根据--artifact-source选择kubelet的来源，格式为<类型>[=<地址>]
+func (op *Options) artifactSource(s *backup.Snapshot) (ArtifactSource, error) {
+	kind, location, _ := strings.Cut(op.ArtifactSource, "=")
+	if op.FromImage {
+		if kind != "" && kind != SourceContainer {
+			return nil, fmt.Errorf("--from-image conflicts with --artifact-source %s", op.ArtifactSource)
+		}
+	}
+	kind = op.sourceKind()
+	if op.KubeVersion == "" && kind != SourceImage && kind != SourceContainer {
+		return nil, errors.New("--kubernetes-version is required to download kubelet, or use --from-image")
+	}
+	switch kind {
+	case SourceHTTP:
+		if location == "" {
+			location = op.HttpRepo
+		}
+		return &httpSource{
+			url:       withSlash(location) + fmt.Sprintf(kubeletName, op.KubeVersion, runtime.GOARCH),
+			publicKey: op.PublicKey,
+			insecure:  op.InsecureSkipVerify,
+		}, nil
+	case SourceRelease:
+		if location == "" {
+			location = defaultReleaseURL
+		}
+		return &releaseSource{
+			url:      fmt.Sprintf("%sv%s/bin/linux/%s/kubelet", withSlash(location), strings.TrimPrefix(op.KubeVersion, "v"), runtime.GOARCH),
+			insecure: op.InsecureSkipVerify,
+		}, nil
+	case SourceLocal:
+		if location == "" {
+			return nil, errors.New("the path of the local artifact is required, for example --artifact-source local=/root/kubernetes-node-linux-amd64.tar.gz")
+		}
+		return &localSource{path: location, version: op.KubeVersion, insecure: op.InsecureSkipVerify}, nil
+	case SourceImage:
+		if s == nil || s.Image() == "" {
+			return nil, errors.New("the image of the kubelet container is unknown")
+		}
+		src := &imageSource{runtime: s.Runtime, image: s.Image(), paths: kubeletPaths(specOf(s).command)}
+		if s.Containerd != nil {
+			src.snapshotter = s.Containerd.Snapshotter
+		}
+		return src, nil
+	case SourceContainer:
+		if s == nil {
+			return nil, errors.New("the kubelet container is unknown")
+		}
+		src := &containerSource{runtime: s.Runtime, name: s.Container, paths: kubeletPaths(specOf(s).command)}
+		switch {
+		case s.Docker != nil && s.Docker.ContainerJSONBase != nil:
+			src.id = s.Docker.ID
+		case s.Containerd != nil:
+			src.id = s.Containerd.ID
+		default:
+			return nil, fmt.Errorf("container %s not found", s.Container)
+		}
+		return src, nil
+	}
+	return nil, fmt.Errorf("unsupported artifact source %q, supported: %s", kind,
+		strings.Join([]string{SourceHTTP, SourceRelease, SourceLocal, SourceImage, SourceContainer}, ","))
+}
+
+// sourceKind kubelet来源的类型
+func (op *Options) sourceKind() string {
+	if op.FromImage {
+		return SourceContainer
+	}
+	kind, _, _ := strings.Cut(op.ArtifactSource, "=")
+	if kind == "" {
+		return SourceHTTP
+	}
+	return kind
+}
+
+// httpSource 仓库中平铺的kubelet-<version>-<arch>
+type httpSource struct {
+	url       string
+	publicKey string
+	insecure  bool
+}
+
+func (h *httpSource) Location() string {
+	return h.url
+}
+
+func (h *httpSource) Check() string {
+	return checkURL(h.url)
+}
+
+func (h *httpSource) Describe() string {
+	if h.insecure {
+		return fmt.Sprintf("download %s without verification", h.url)
+	}
+	step := fmt.Sprintf("download %s and verify its sha256 against %s", h.url, h.sumsURL())
+	if h.publicKey != "" {
+		step += fmt.Sprintf(", signed with %s", h.sumsURL()+sigSuffix)
+	}
+	return step
+}
+
+func (h *httpSource) Fetch(destinationFile string) error {
+	sum := ""
+	if !h.insecure {
+		sums, err := h.checksums()
+		if err != nil {
+			return err
+		}
+		var ok bool
+		if sum, ok = sums[path.Base(h.url)]; !ok {
+			return fmt.Errorf("no checksum of %s in %s", path.Base(h.url), h.sumsURL())
+		}
+	}
+	return utils.DownloadFileWithSHA256(h.url, destinationFile, sum)
+}
+
+func (h *httpSource) sumsURL() string {
+	return h.url[:strings.LastIndex(h.url, "/")+1] + sumsFile
+}
+
+// releaseSource 与dl.k8s.io相同的目录结构
+type releaseSource struct {
+	url      string
+	insecure bool
+}
+
+func (r *releaseSource) Location() string {
+	return r.url
+}
+
+func (r *releaseSource) Check() string {
+	return checkURL(r.url)
+}
+
+func (r *releaseSource) Describe() string {
+	if r.insecure {
+		return fmt.Sprintf("download %s without verification", r.url)
+	}
+	return fmt.Sprintf("download %s and verify its sha256 against %s.sha256", r.url, r.url)
+}
+
+func (r *releaseSource) Fetch(destinationFile string) error {
+	sum := ""
+	if !r.insecure {
+		data, err := httpGet(r.url + ".sha256")
+		if err != nil {
+			return fmt.Errorf("failed to download %s.sha256: %v", r.url, err)
+		}
+		fields := strings.Fields(string(data))
+		if len(fields) == 0 || len(fields[0]) != 64 {
+			return fmt.Errorf("invalid checksum in %s.sha256", r.url)
+		}
+		sum = fields[0]
+	}
+	return utils.DownloadFileWithSHA256(r.url, destinationFile, sum)
+}
+
+// localSource 节点上的文件，使用同目录中的SHA256SUMS校验，没有时需要--insecure-skip-verify
+type localSource struct {
+	path     string
+	version  string
+	insecure bool
+}
+
+// file 来源是目录时依次查找kubelet-<version>-<arch>和kubernetes-node-linux-<arch>.tar.gz
+func (l *localSource) file() (string, error) {
+	if !utils.IsDir(l.path) {
+		if !utils.Exists(l.path) {
+			return "", fmt.Errorf("%s does not exist", l.path)
+		}
+		return l.path, nil
+	}
+	for _, name := range []string{fmt.Sprintf(kubeletName, l.version, runtime.GOARCH), fmt.Sprintf(nodeTarball, runtime.GOARCH)} {
+		if file := path.Join(l.path, name); utils.Exists(file) {
+			return file, nil
+		}
+	}
+	return "", fmt.Errorf("neither %s nor %s found in %s", fmt.Sprintf(kubeletName, l.version, runtime.GOARCH),
+		fmt.Sprintf(nodeTarball, runtime.GOARCH), l.path)
+}
+
+func (l *localSource) Location() string {
+	if file, err := l.file(); err == nil {
+		return file
+	}
+	return l.path
+}
+
+func (l *localSource) Check() string {
+	file, err := l.file()
+	if err != nil {
+		return err.Error()
+	}
+	if sums := path.Join(path.Dir(file), sumsFile); !l.insecure && !utils.Exists(sums) {
+		return fmt.Sprintf("%s not found", sums)
+	}
+	return "available"
+}
+
+func (l *localSource) Describe() string {
+	file, err := l.file()
+	if err != nil {
+		file = l.path
+	}
+	step := fmt.Sprintf("copy %s", file)
+	if isTarball(file) {
+		step = fmt.Sprintf("extract %s from %s", tarballKubelet, file)
+	}
+	switch sums := path.Join(path.Dir(file), sumsFile); {
+	case l.insecure:
+		step += " without verification"
+	case utils.Exists(sums):
+		step += fmt.Sprintf(" and verify its sha256 against %s", sums)
+	default:
+		step += fmt.Sprintf(", fails as there is no %s to verify it", sums)
+	}
+	return step
+}
+
+func (l *localSource) Fetch(destinationFile string) error {
+	file, err := l.file()
+	if err != nil {
+		return err
+	}
+	sum := ""
+	if sums := path.Join(path.Dir(file), sumsFile); !l.insecure && utils.Exists(sums) {
+		data, err := os.ReadFile(sums)
+		if err != nil {
+			return err
+		}
+		var ok bool
+		if sum, ok = parseSums(data)[path.Base(file)]; !ok {
+			return fmt.Errorf("no checksum of %s in %s", path.Base(file), sums)
+		}
+	} else if !l.insecure {
+		return fmt.Errorf("no %s next to %s to verify it, use --insecure-skip-verify to install it without verification", sumsFile, file)
+	}
+
+	if !isTarball(file) {
+		f, err := os.Open(file)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		return utils.SaveFile(f, destinationFile, sum)
+	}
+	if sum != "" {
+		actual, err := fileSHA256(file)
+		if err != nil {
+			return err
+		}
+		if !strings.EqualFold(actual, sum) {
+			return fmt.Errorf("sha256 of %s is %s, expected %s", file, actual, sum)
+		}
+	}
+	return utils.ExtractFromTarball(file, tarballKubelet, destinationFile, "")
+}
+
+// imageSource kubelet容器使用的镜像，保证转换前后kubelet的版本一致
+type imageSource struct {
+	runtime     string
+	image       string
+	snapshotter string
+	// 镜像中kubelet可能的路径
+	paths []string
+}
+
+func (i *imageSource) Location() string {
+	return i.image
+}
+
+func (i *imageSource) Check() string {
+	return "available"
+}
+
+func (i *imageSource) Describe() string {
+	return fmt.Sprintf("copy %s from image %s", i.paths[0], i.image)
+}
+
+func (i *imageSource) Fetch(destinationFile string) error {
+	var err error
+	for _, p := range i.paths {
+		if i.runtime == "docker" {
+			err = global.Docker.CopyFromImage(i.image, p, destinationFile, "")
+		} else {
+			err = global.Containerd.CopyFromImage(i.image, i.snapshotter, p, destinationFile, "")
+		}
+		if err == nil {
+			log.Infof("copy %s from image %s", p, i.image)
+			return nil
+		}
+		log.Debugf("copy %s from image %s error: %v", p, i.image, err)
+	}
+	return fmt.Errorf("kubelet not found in image %s: %v", i.image, err)
+}
+
+// containerSource 正在运行的kubelet容器
+type containerSource struct {
+	runtime string
+	name    string
+	id      string
+	// 容器中kubelet可能的路径
+	paths []string
+}
+
+func (c *containerSource) Location() string {
+	return fmt.Sprintf("%s container %s", c.runtime, c.name)
+}
+
+func (c *containerSource) Check() string {
+	return "available"
+}
+
+func (c *containerSource) Describe() string {
+	return fmt.Sprintf("copy %s from the running %s container %s", c.paths[0], c.runtime, c.name)
+}
+
+func (c *containerSource) Fetch(destinationFile string) error {
+	var err error
+	for _, p := range c.paths {
+		if c.runtime == "docker" {
+			err = global.Docker.CopyFromContainer(c.id, p, destinationFile, "")
+		} else {
+			err = global.Containerd.CopyFromContainer(c.id, p, destinationFile, "")
+		}
+		if err == nil {
+			log.Infof("copy %s from container %s", p, c.name)
+			return nil
+		}
+		log.Debugf("copy %s from container %s error: %v", p, c.name, err)
+	}
+	return fmt.Errorf("kubelet not found in container %s: %v", c.name, err)
+}
+
+// kubeletPaths 镜像中kubelet可能的路径，容器启动命令中kubelet的绝对路径优先
+func kubeletPaths(command []string) []string {
+	paths := []string{}
+	for _, c := range command {
+		if path.Base(c) == "kubelet" && path.IsAbs(c) {
+			paths = append(paths, c)
+			break
+		}
+	}
+	for _, p := range imageKubeletPaths {
+		if !utils.ContainsString(paths, p) {
+			paths = append(paths, p)
+		}
+	}
+	return paths
+}
+
+func isTarball(file string) bool {
+	return strings.HasSuffix(file, ".tar.gz") || strings.HasSuffix(file, ".tgz")
+}
+
+func withSlash(url string) string {
+	if strings.HasSuffix(url, "/") {
+		return url
+	}
+	return url + "/"
+}
+
+func fileSHA256(file string) (string, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err = io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
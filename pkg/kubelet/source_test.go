@@ -0,0 +1,176 @@
+package kubelet
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"crypto/sha256"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"reflect"
+	"runtime"
+	"testing"
+	"transform/pkg/backup"
+
+	"github.com/docker/docker/api/types"
+)
+
+func TestArtifactSource(t *testing.T) {
+	tests := []struct {
+		source   string
+		location string
+	}{
+		{"", fmt.Sprintf("http://repo/files/kubelet-1.21.13-%s", runtime.GOARCH)},
+		{"http=http://mirror/kubelet", fmt.Sprintf("http://mirror/kubelet/kubelet-1.21.13-%s", runtime.GOARCH)},
+		{"release", fmt.Sprintf("https://dl.k8s.io/release/v1.21.13/bin/linux/%s/kubelet", runtime.GOARCH)},
+		{"release=http://mirror/release", fmt.Sprintf("http://mirror/release/v1.21.13/bin/linux/%s/kubelet", runtime.GOARCH)},
+		{"local=/root/kubelet", "/root/kubelet"},
+	}
+	for _, tt := range tests {
+		op := &Options{HttpRepo: "http://repo/files/", KubeVersion: "1.21.13", ArtifactSource: tt.source}
+		src, err := op.artifactSource(nil)
+		if err != nil {
+			t.Errorf("artifactSource(%q) error: %v", tt.source, err)
+			continue
+		}
+		if got := src.Location(); got != tt.location {
+			t.Errorf("artifactSource(%q).Location() = %s, want %s", tt.source, got, tt.location)
+		}
+	}
+	for _, source := range []string{"local", "image", "ftp"} {
+		op := &Options{ArtifactSource: source}
+		if _, err := op.artifactSource(nil); err == nil {
+			t.Errorf("artifactSource(%q) succeeded", source)
+		}
+	}
+}
+
+func TestFromImage(t *testing.T) {
+	s := &backup.Snapshot{
+		Runtime:   "docker",
+		Container: "kubelet",
+		Docker: &types.ContainerJSON{
+			ContainerJSONBase: &types.ContainerJSONBase{ID: "abc", Path: "/usr/bin/kubelet"},
+		},
+	}
+	op := &Options{FromImage: true}
+	src, err := op.artifactSource(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, ok := src.(*containerSource)
+	if !ok || c.id != "abc" || c.paths[0] != "/usr/bin/kubelet" {
+		t.Errorf("artifactSource() = %#v", src)
+	}
+
+	op.ArtifactSource = SourceRelease
+	if _, err = op.artifactSource(s); err == nil {
+		t.Error("--from-image with --artifact-source release succeeded")
+	}
+}
+
+func TestReleaseSource(t *testing.T) {
+	binary := []byte("kubelet")
+	sum := sha256.Sum256(binary)
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch path.Base(r.URL.Path) {
+		case "kubelet":
+			_, _ = w.Write(binary)
+		case "kubelet.sha256":
+			_, _ = fmt.Fprintf(w, "%x  kubelet\n", sum)
+		}
+	}))
+	defer s.Close()
+
+	op := &Options{KubeVersion: "v1.26.15", ArtifactSource: SourceRelease + "=" + s.URL}
+	src, err := op.artifactSource(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dst := path.Join(t.TempDir(), "kubelet")
+	if err = src.Fetch(dst); err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := os.ReadFile(dst); string(b) != string(binary) {
+		t.Errorf("fetched %q", b)
+	}
+
+	binary = []byte("tampered")
+	if err = src.Fetch(dst); err == nil {
+		t.Error("Fetch() of tampered kubelet succeeded")
+	}
+}
+
+func TestLocalSource(t *testing.T) {
+	dir := t.TempDir()
+	tarball := path.Join(dir, fmt.Sprintf(nodeTarball, runtime.GOARCH))
+	f, err := os.Create(tarball)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gz := gzip.NewWriter(f)
+	tw := tar.NewWriter(gz)
+	for _, file := range []string{"kubernetes/node/bin/kubeadm", tarballKubelet} {
+		content := []byte(path.Base(file))
+		_ = tw.WriteHeader(&tar.Header{Name: file, Mode: 0755, Size: int64(len(content)), Typeflag: tar.TypeReg})
+		_, _ = tw.Write(content)
+	}
+	_ = tw.Close()
+	_ = gz.Close()
+	_ = f.Close()
+
+	src := &localSource{path: dir, version: "1.21.13"}
+	if got := src.Location(); got != tarball {
+		t.Errorf("Location() = %s, want %s", got, tarball)
+	}
+	// 没有SHA256SUMS时只在--insecure-skip-verify下安装
+	dst := path.Join(t.TempDir(), "kubelet")
+	if err = src.Fetch(dst); err == nil {
+		t.Error("Fetch() without SHA256SUMS succeeded")
+	}
+	if _, err = os.Stat(dst); !os.IsNotExist(err) {
+		t.Errorf("%s is written without verification", dst)
+	}
+	src.insecure = true
+	if err = src.Fetch(dst); err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := os.ReadFile(dst); string(b) != "kubelet" {
+		t.Errorf("extracted %q", b)
+	}
+	src.insecure = false
+
+	sum, err := fileSHA256(tarball)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = os.WriteFile(path.Join(dir, sumsFile), []byte(fmt.Sprintf("%s  %s\n", sum, path.Base(tarball))), 0644); err != nil {
+		t.Fatal(err)
+	}
+	_ = os.Remove(dst)
+	if err = src.Fetch(dst); err != nil {
+		t.Fatal(err)
+	}
+
+	// 同目录中的SHA256SUMS与压缩包不一致
+	sums := fmt.Sprintf("%x  %s\n", sha256.Sum256([]byte("other")), path.Base(tarball))
+	if err = os.WriteFile(path.Join(dir, sumsFile), []byte(sums), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err = src.Fetch(dst); err == nil {
+		t.Error("Fetch() with mismatched checksum succeeded")
+	}
+}
+
+func TestKubeletPaths(t *testing.T) {
+	got := kubeletPaths([]string{"/opt/bin/kubelet", "--v=2"})
+	want := append([]string{"/opt/bin/kubelet"}, imageKubeletPaths...)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("kubeletPaths() = %v, want %v", got, want)
+	}
+	if got = kubeletPaths([]string{"kubelet"}); !reflect.DeepEqual(got, imageKubeletPaths) {
+		t.Errorf("kubeletPaths() = %v, want %v", got, imageKubeletPaths)
+	}
+}
@@ -0,0 +1,297 @@
+package kubelet
+
+import (
+	"bytes"
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"transform/pkg/backup"
+	"transform/utils"
+
+	"github.com/docker/docker/api/types"
+)
+
+// containerSpec 与运行时无关的kubelet容器描述
+type containerSpec struct {
+	command []string
+	env     []string
+	user    string
+	mounts  []backup.Mount
+	// 资源限制，0表示不限制
+	memory    int64
+	cpuQuota  int64
+	cpuPeriod int64
+	pids      int64
+	rlimits   map[string]uint64
+}
+
+// unit 生成kubelet.service所需的内容
+type unit struct {
+	ExecStart   string
+	Environment []string
+	User        string
+	Resources   []string
+	LimitNOFILE string
+	LimitNPROC  string
+	LimitCORE   string
+}
+
+var kubeletServiceTmpl = template.Must(template.New("kubelet.service").Parse(kubeletService))
+
+// 容器运行时自动注入、在宿主机上没有意义的环境变量
+var ignoredEnv = []string{"PATH", "HOSTNAME", "HOME"}
+
+// 容器运行时自动生成的挂载，转换后直接使用宿主机上的文件
+var ignoredMounts = []string{"/etc/resolv.conf", "/etc/hosts", "/etc/hostname"}
+
+// kubelet的默认工作目录，被重新映射时需要显式指定--root-dir
+const defaultRootDir = "/var/lib/kubelet"
+
+// translate 将kubelet容器的启动命令、环境变量、挂载和资源限制转换为等价的systemd unit，
+// 无法等价转换的部分以警告的形式返回
+func translate(s *backup.Snapshot) (*unit, []string) {
+	spec := specOf(s)
+
+	warnings := []string{}
+	args, ok := kubeletArgs(spec.command)
+	if !ok {
+		warnings = append(warnings, fmt.Sprintf("kubelet executable not found in container command %q, all arguments are kept", strings.Join(spec.command, " ")))
+	}
+
+	args, mountWarnings := rewriteMounts(args, spec.mounts)
+	warnings = append(warnings, mountWarnings...)
+
+	u := &unit{
+		ExecStart:   execStart(utils.KubeletBinary, args),
+		LimitNOFILE: "infinity",
+		LimitNPROC:  "infinity",
+		LimitCORE:   "infinity",
+	}
+	for _, env := range spec.env {
+		name := strings.SplitN(env, "=", 2)[0]
+		if name == "" || utils.ContainsString(ignoredEnv, name) {
+			continue
+		}
+		u.Environment = append(u.Environment, quoteEnv(env))
+	}
+	if spec.user != "" && spec.user != "root" && spec.user != "0" && spec.user != "0:0" {
+		u.User = spec.user
+	}
+
+	if spec.memory > 0 {
+		u.Resources = append(u.Resources, fmt.Sprintf("MemoryMax=%d", spec.memory))
+	}
+	if spec.cpuQuota > 0 {
+		period := spec.cpuPeriod
+		if period <= 0 {
+			period = 100000
+		}
+		u.Resources = append(u.Resources, fmt.Sprintf("CPUQuota=%d%%", spec.cpuQuota*100/period))
+	}
+	if spec.pids > 0 {
+		u.Resources = append(u.Resources, fmt.Sprintf("TasksMax=%d", spec.pids))
+	}
+	names := make([]string, 0, len(spec.rlimits))
+	for name := range spec.rlimits {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		limit := strconv.FormatUint(spec.rlimits[name], 10)
+		switch name {
+		case "nofile":
+			u.LimitNOFILE = limit
+		case "nproc":
+			u.LimitNPROC = limit
+		case "core":
+			u.LimitCORE = limit
+		default:
+			warnings = append(warnings, fmt.Sprintf("ulimit %s=%s of the container is not translated", name, limit))
+		}
+	}
+	return u, warnings
+}
+
+// render 渲染kubelet.service文件内容
+func (u *unit) render() (string, error) {
+	buf := new(bytes.Buffer)
+	if err := kubeletServiceTmpl.Execute(buf, u); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// specOf 按运行时读取kubelet容器的描述
+func specOf(s *backup.Snapshot) containerSpec {
+	if s.Docker != nil {
+		return specFromDocker(s.Docker)
+	}
+	return specFromContainerd(s)
+}
+
+func specFromDocker(info *types.ContainerJSON) containerSpec {
+	spec := containerSpec{
+		command: append([]string{info.Path}, info.Args...),
+		rlimits: map[string]uint64{},
+	}
+	if info.Config != nil {
+		spec.env = info.Config.Env
+		spec.user = info.Config.User
+	}
+	for _, m := range info.Mounts {
+		spec.mounts = append(spec.mounts, backup.Mount{Type: string(m.Type), Source: m.Source, Destination: m.Destination, RW: m.RW})
+	}
+	if info.HostConfig != nil {
+		r := info.HostConfig.Resources
+		spec.memory = r.Memory
+		spec.cpuQuota = r.CPUQuota
+		spec.cpuPeriod = r.CPUPeriod
+		if r.NanoCPUs > 0 {
+			spec.cpuQuota = r.NanoCPUs / 10000
+			spec.cpuPeriod = 100000
+		}
+		if r.PidsLimit != nil {
+			spec.pids = *r.PidsLimit
+		}
+		for _, u := range r.Ulimits {
+			if u != nil && u.Hard > 0 {
+				spec.rlimits[u.Name] = uint64(u.Hard)
+			}
+		}
+	}
+	return spec
+}
+
+// specFromContainerd 读取containerd中记录的OCI配置
+func specFromContainerd(s *backup.Snapshot) containerSpec {
+	spec := containerSpec{rlimits: map[string]uint64{}}
+	if s.Containerd == nil || s.Containerd.Spec == nil || s.Containerd.Spec.Process == nil {
+		return spec
+	}
+
+	oci := s.Containerd.Spec
+	spec.command = oci.Process.Args
+	spec.env = oci.Process.Env
+	if oci.Process.User.UID != 0 {
+		spec.user = strconv.FormatUint(uint64(oci.Process.User.UID), 10)
+	}
+	spec.mounts = s.Mounts()
+	for _, r := range oci.Process.Rlimits {
+		spec.rlimits[strings.ToLower(strings.TrimPrefix(r.Type, "RLIMIT_"))] = r.Hard
+	}
+	if oci.Linux != nil && oci.Linux.Resources != nil {
+		r := oci.Linux.Resources
+		if r.Memory != nil && r.Memory.Limit != nil {
+			spec.memory = *r.Memory.Limit
+		}
+		if r.CPU != nil {
+			if r.CPU.Quota != nil {
+				spec.cpuQuota = *r.CPU.Quota
+			}
+			if r.CPU.Period != nil {
+				spec.cpuPeriod = int64(*r.CPU.Period)
+			}
+		}
+		if r.Pids != nil {
+			spec.pids = r.Pids.Limit
+		}
+	}
+	return spec
+}
+
+// kubeletArgs 从容器的完整启动命令（entrypoint + cmd）中取出kubelet的参数
+func kubeletArgs(command []string) ([]string, bool) {
+	for i, c := range command {
+		if path.Base(c) == "kubelet" {
+			return command[i+1:], true
+		}
+	}
+	if len(command) > 0 && command[0] == "" {
+		command = command[1:]
+	}
+	return command, false
+}
+
+// rewriteMounts 将参数中容器内的路径替换为宿主机上挂载的源路径
+func rewriteMounts(args []string, mounts []backup.Mount) ([]string, []string) {
+	warnings := []string{}
+	remapped := []backup.Mount{}
+	for _, m := range mounts {
+		if utils.ContainsString(ignoredMounts, m.Destination) {
+			continue
+		}
+		switch {
+		case m.Source == "":
+			warnings = append(warnings, fmt.Sprintf("%s mount at %s has no host equivalent, its content will be lost", m.Type, m.Destination))
+		case m.Type == "volume" || path.Clean(m.Source) != path.Clean(m.Destination):
+			remapped = append(remapped, m)
+		}
+	}
+	// 最长前缀优先匹配
+	sort.SliceStable(remapped, func(i, j int) bool {
+		return len(remapped[i].Destination) > len(remapped[j].Destination)
+	})
+
+	result := make([]string, 0, len(args))
+	used := map[string]bool{}
+	for _, arg := range args {
+		prefix, value := "", arg
+		if strings.HasPrefix(arg, "-") {
+			kv := strings.SplitN(arg, "=", 2)
+			if len(kv) != 2 {
+				result = append(result, arg)
+				continue
+			}
+			prefix, value = kv[0]+"=", kv[1]
+		}
+		for _, m := range remapped {
+			if rewritten, ok := rewritePath(value, m); ok {
+				used[m.Destination] = true
+				value = rewritten
+				break
+			}
+		}
+		result = append(result, prefix+value)
+	}
+
+	for _, m := range remapped {
+		if used[m.Destination] {
+			if m.Type == "volume" {
+				warnings = append(warnings, fmt.Sprintf("named volume mounted at %s is replaced by its host path %s", m.Destination, m.Source))
+			}
+			continue
+		}
+		if path.Clean(m.Destination) == defaultRootDir && !hasFlag(result, "--root-dir") {
+			result = append(result, "--root-dir="+m.Source)
+			continue
+		}
+		warnings = append(warnings, fmt.Sprintf("host path %s was mounted at %s in the container, the binary kubelet will use %s instead", m.Source, m.Destination, m.Destination))
+	}
+	return result, warnings
+}
+
+func rewritePath(value string, m backup.Mount) (string, bool) {
+	dst := path.Clean(m.Destination)
+	if dst == "/" || !strings.HasPrefix(value, "/") {
+		return value, false
+	}
+	if value == dst {
+		return m.Source, true
+	}
+	if strings.HasPrefix(value, dst+"/") {
+		return path.Join(m.Source, strings.TrimPrefix(value, dst)), true
+	}
+	return value, false
+}
+
+func hasFlag(args []string, flag string) bool {
+	for _, arg := range args {
+		if arg == flag || strings.HasPrefix(arg, flag+"=") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,113 @@
+package kubelet
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"transform/pkg/backup"
+	"transform/pkg/executor/containerd"
+
+	"github.com/containerd/containerd/oci"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/mount"
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+)
+
+// TestTranslateDocker 验证docker容器的参数、环境变量、挂载和资源限制的转换
+func TestTranslateDocker(t *testing.T) {
+	pids := int64(4096)
+	info := types.ContainerJSON{
+		ContainerJSONBase: &types.ContainerJSONBase{
+			Path: "/usr/local/bin/kubelet",
+			Args: []string{"--config=/var/lib/kubelet/config.yaml", "--kubeconfig", "/etc/kubernetes/kubelet.conf", "--cert-dir=/certs/pki"},
+			HostConfig: &container.HostConfig{
+				Resources: container.Resources{Memory: 1 << 30, NanoCPUs: 2000000000, PidsLimit: &pids},
+			},
+		},
+		Config: &container.Config{
+			Env: []string{"PATH=/usr/local/bin:/usr/bin", "HTTP_PROXY=http://proxy:3128", `GREETING=say "hi" 100%`},
+		},
+		Mounts: []types.MountPoint{
+			{Type: mount.TypeBind, Source: "/data/kubelet", Destination: "/var/lib/kubelet", RW: true},
+			{Type: mount.TypeBind, Source: "/etc/kubernetes", Destination: "/etc/kubernetes"},
+			{Type: mount.TypeBind, Source: "/opt/pki", Destination: "/certs"},
+			{Type: mount.TypeBind, Source: "/opt/plugins", Destination: "/usr/libexec/kubernetes"},
+			{Type: mount.TypeVolume, Source: "/var/lib/docker/volumes/logs/_data", Destination: "/var/log/pods"},
+		},
+	}
+
+	u, warnings := translate(&backup.Snapshot{Docker: &info})
+
+	wantExec := "/usr/bin/kubelet --config=/data/kubelet/config.yaml --kubeconfig /etc/kubernetes/kubelet.conf --cert-dir=/opt/pki/pki"
+	if u.ExecStart != wantExec {
+		t.Errorf("ExecStart = %q, want %q", u.ExecStart, wantExec)
+	}
+	wantEnv := []string{`HTTP_PROXY=http://proxy:3128`, `"GREETING=say \"hi\" 100%%"`}
+	if !reflect.DeepEqual(u.Environment, wantEnv) {
+		t.Errorf("Environment = %v, want %v", u.Environment, wantEnv)
+	}
+	wantResources := []string{"MemoryMax=1073741824", "CPUQuota=200%", "TasksMax=4096"}
+	if !reflect.DeepEqual(u.Resources, wantResources) {
+		t.Errorf("Resources = %v, want %v", u.Resources, wantResources)
+	}
+	if len(warnings) != 2 || !strings.Contains(warnings[0], "/usr/libexec/kubernetes") || !strings.Contains(warnings[1], "/var/log/pods") {
+		t.Errorf("unexpected warnings %v", warnings)
+	}
+	if _, err := u.render(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestTranslateContainerd 验证只有containerd中OCI配置的容器的参数、环境变量、挂载和资源限制的转换
+func TestTranslateContainerd(t *testing.T) {
+	memory := int64(1 << 30)
+	info := containerd.ContainerInfo{
+		ID:   "0123456789",
+		Name: "kubelet",
+		Spec: &oci.Spec{
+			Process: &specs.Process{
+				Args:    []string{"/usr/bin/kubelet", "--config=/var/lib/kubelet/config.yaml"},
+				Env:     []string{"PATH=/usr/bin", "HTTP_PROXY=http://proxy:3128"},
+				Rlimits: []specs.POSIXRlimit{{Type: "RLIMIT_NOFILE", Hard: 1048576, Soft: 1048576}},
+			},
+			Mounts: []specs.Mount{
+				{Type: "bind", Source: "/data/kubelet", Destination: "/var/lib/kubelet", Options: []string{"rbind", "rw"}},
+				{Type: "bind", Source: "/etc/kubernetes", Destination: "/etc/kubernetes", Options: []string{"rbind", "ro"}},
+				{Type: "proc", Source: "proc", Destination: "/proc"},
+			},
+			Linux: &specs.Linux{Resources: &specs.LinuxResources{Memory: &specs.LinuxMemory{Limit: &memory}}},
+		},
+	}
+	s := &backup.Snapshot{Runtime: "containerd", Container: "kubelet", Containerd: &info}
+	if got := s.Args(); !reflect.DeepEqual(got, []string{"--config=/var/lib/kubelet/config.yaml"}) {
+		t.Errorf("Args() = %v", got)
+	}
+	if got := s.Mounts(); len(got) != 2 || !got[0].RW || got[1].RW {
+		t.Errorf("Mounts() = %v", got)
+	}
+
+	u, _ := translate(s)
+	wantExec := "/usr/bin/kubelet --config=/data/kubelet/config.yaml"
+	if u.ExecStart != wantExec {
+		t.Errorf("ExecStart = %q, want %q", u.ExecStart, wantExec)
+	}
+	if !reflect.DeepEqual(u.Environment, []string{"HTTP_PROXY=http://proxy:3128"}) {
+		t.Errorf("Environment = %v", u.Environment)
+	}
+	if u.LimitNOFILE != "1048576" || !reflect.DeepEqual(u.Resources, []string{"MemoryMax=1073741824"}) {
+		t.Errorf("LimitNOFILE = %s, Resources = %v", u.LimitNOFILE, u.Resources)
+	}
+}
+
+// TestRewriteMountsRootDir 默认工作目录被重新映射时需要补充--root-dir
+func TestRewriteMountsRootDir(t *testing.T) {
+	args, warnings := rewriteMounts([]string{"--v=2"}, []backup.Mount{
+		{Type: "bind", Source: "/data/kubelet", Destination: "/var/lib/kubelet"},
+	})
+	want := []string{"--v=2", "--root-dir=/data/kubelet"}
+	if !reflect.DeepEqual(args, want) || len(warnings) != 0 {
+		t.Errorf("args = %v, warnings = %v, want %v", args, warnings, want)
+	}
+}
@@ -0,0 +1,403 @@
+package kubelet
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+	"transform/pkg/global"
+	"transform/pkg/report"
+	"transform/utils"
+
+	"gopkg.in/yaml.v3"
+)
+
+// 巡检kubelet.service的间隔
+var verifyInterval = 15 * time.Second
+
+const (
+	defaultHealthzPort   = 10248
+	defaultStaticPodPath = "/etc/kubernetes/manifests"
+)
+
+// kubeletConfig --config指定的KubeletConfiguration中校验需要的字段
+type kubeletConfig struct {
+	HealthzPort              *int   `yaml:"healthzPort"`
+	HealthzBindAddress       string `yaml:"healthzBindAddress"`
+	StaticPodPath            string `yaml:"staticPodPath"`
+	ContainerRuntimeEndpoint string `yaml:"containerRuntimeEndpoint"`
+}
+
+// criPod 通过CRI查询到的pod
+type criPod struct {
+	Namespace string
+	Name      string
+	Ready     bool
+}
+
+// verifier 转换后检查kubelet是否真正正常工作，每项检查对应报告中的一条记录
+type verifier struct {
+	runtime string
+	version string
+	args    []string
+	config  kubeletConfig
+	// 转换前正在运行的pod，转换后需要仍然运行
+	pods    []criPod
+	podsErr error
+}
+
+// newVerifier 从将要写入的unit文件和kubelet的配置文件中读取校验所需的端口、路径等
+func newVerifier(op *Options, unit string) (*verifier, error) {
+	v := &verifier{runtime: op.Runtime, version: op.KubeVersion}
+	for _, line := range strings.Split(unit, "\n") {
+		if !strings.HasPrefix(line, "ExecStart=") {
+			continue
+		}
+		words, err := splitExecStart(strings.TrimPrefix(line, "ExecStart="))
+		if err != nil {
+			return nil, err
+		}
+		if len(words) > 0 {
+			v.args = words[1:]
+		}
+	}
+	if config, ok := flagValue(v.args, "--config"); ok {
+		b, err := os.ReadFile(config)
+		if err != nil {
+			return nil, err
+		}
+		if err = yaml.Unmarshal(b, &v.config); err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %v", config, err)
+		}
+	}
+	return v, nil
+}
+
+// recordPods 转换前记录正在运行的pod
+func (v *verifier) recordPods() {
+	v.pods, v.podsErr = listPods(v.endpoint())
+}
+
+// verify 执行所有检查
+func (v *verifier) verify() []report.CaseInfo {
+	checks := []struct {
+		name string
+		fn   func() (string, error)
+	}{
+		{"kubelet healthz", v.checkHealthz},
+		{"kubelet进程", v.checkProcess},
+		{"kubelet版本", v.checkVersion},
+		{"静态pod", v.checkStaticPods},
+		{"节点pod", v.checkPods},
+	}
+	cases := []report.CaseInfo{}
+	for _, check := range checks {
+		startTime := time.Now()
+		c := report.CaseInfo{
+			Identify: "verify",
+			Role:     "kubelet转换",
+			Name:     check.name,
+			Status:   report.Success,
+		}
+		detail, err := check.fn()
+		switch {
+		case errors.Is(err, errSkipped):
+			c.Status = report.Warning
+			c.Detail = detail
+		case err != nil:
+			c.Status = report.Failure
+			c.Detail = err.Error()
+		default:
+			c.Detail = detail
+		}
+		c.DurationTime = time.Now().Sub(startTime).String()
+		cases = append(cases, c)
+	}
+	return cases
+}
+
+// errSkipped 检查条件不满足时跳过检查，在报告中显示为警告
+var errSkipped = errors.New("skipped")
+
+// passed 是否所有检查都没有失败
+func passed(cases []report.CaseInfo) bool {
+	for _, c := range cases {
+		if c.Status == report.Failure {
+			return false
+		}
+	}
+	return true
+}
+
+func (v *verifier) healthzURL() string {
+	port := defaultHealthzPort
+	if v.config.HealthzPort != nil {
+		port = *v.config.HealthzPort
+	}
+	if p, ok := flagValue(v.args, "--healthz-port"); ok {
+		if n, err := strconv.Atoi(p); err == nil {
+			port = n
+		}
+	}
+	address := v.config.HealthzBindAddress
+	if a, ok := flagValue(v.args, "--healthz-bind-address"); ok {
+		address = a
+	}
+	switch address {
+	case "", "0.0.0.0":
+		address = "127.0.0.1"
+	case "::":
+		address = "::1"
+	}
+	return fmt.Sprintf("http://%s/healthz", net.JoinHostPort(address, strconv.Itoa(port)))
+}
+
+func (v *verifier) checkHealthz() (string, error) {
+	if port, ok := flagValue(v.args, "--healthz-port"); ok && port == "0" {
+		return "healthz endpoint is disabled", errSkipped
+	}
+	return checkHealthz(v.healthzURL())
+}
+
+func checkHealthz(url string) (string, error) {
+	client := http.Client{Timeout: 5 * time.Second}
+	resp, err := client.Get(url)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	if resp.StatusCode != http.StatusOK || strings.TrimSpace(string(body)) != "ok" {
+		return "", fmt.Errorf("%s returned %s: %s", url, resp.Status, strings.TrimSpace(string(body)))
+	}
+	return url + " is ok", nil
+}
+
+// checkProcess 确认kubelet.service的主进程是新的二进制文件
+func (v *verifier) checkProcess() (string, error) {
+	out, err := global.Command.ExecuteCommandWithOutput("systemctl", "show", "-p", "MainPID", "--value", "kubelet")
+	if err != nil {
+		return "", err
+	}
+	pid := strings.TrimSpace(out)
+	if pid == "" || pid == "0" {
+		return "", errors.New("kubelet.service has no main process")
+	}
+	exe, err := os.Readlink(fmt.Sprintf("/proc/%s/exe", pid))
+	if err != nil {
+		return "", err
+	}
+	if exe != utils.KubeletBinary {
+		return "", fmt.Errorf("process %s runs %s instead of %s", pid, exe, utils.KubeletBinary)
+	}
+	return fmt.Sprintf("process %s runs %s", pid, exe), nil
+}
+
+// checkVersion 确认kubelet的版本与指定的版本一致
+func (v *verifier) checkVersion() (string, error) {
+	version, err := kubeletVersion(utils.KubeletBinary)
+	if err != nil {
+		return "", err
+	}
+	if !sameVersion(version, v.version) {
+		return "", fmt.Errorf("kubelet %s does not match the expected version %s", version, v.version)
+	}
+	return fmt.Sprintf("Kubernetes %s", version), nil
+}
+
+// kubeletVersion 执行kubelet --version获取版本，输出的格式为Kubernetes v1.21.13
+func kubeletVersion(binary string) (string, error) {
+	out, err := global.Command.ExecuteCommandWithOutput(binary, "--version")
+	if err != nil {
+		return "", err
+	}
+	fields := strings.Fields(out)
+	if len(fields) == 0 {
+		return "", fmt.Errorf("unexpected output of %s --version: %q", binary, out)
+	}
+	return fields[len(fields)-1], nil
+}
+
+func sameVersion(a, b string) bool {
+	return strings.TrimPrefix(a, "v") == strings.TrimPrefix(b, "v")
+}
+
+// checkStaticPods 确认静态pod目录中的每个pod都在运行
+func (v *verifier) checkStaticPods() (string, error) {
+	dir := defaultStaticPodPath
+	if v.config.StaticPodPath != "" {
+		dir = v.config.StaticPodPath
+	}
+	if p, ok := flagValue(v.args, "--pod-manifest-path"); ok {
+		dir = p
+	}
+	manifests, err := staticPods(dir)
+	if err != nil {
+		return "", err
+	}
+	if len(manifests) == 0 {
+		return "no static pod in " + dir, nil
+	}
+	pods, err := listPods(v.endpoint())
+	if err != nil {
+		return err.Error(), errSkipped
+	}
+	missing := []string{}
+	for _, m := range manifests {
+		found := false
+		for _, p := range pods {
+			// 静态pod的名称为<name>-<节点名称>
+			if p.Ready && p.Namespace == m.Namespace && strings.HasPrefix(p.Name, m.Name+"-") {
+				found = true
+				break
+			}
+		}
+		if !found {
+			missing = append(missing, m.Namespace+"/"+m.Name)
+		}
+	}
+	if len(missing) > 0 {
+		return "", fmt.Errorf("static pods are not running: %s", strings.Join(missing, ","))
+	}
+	return fmt.Sprintf("%d static pods are running", len(manifests)), nil
+}
+
+// checkPods 确认转换前运行的pod在转换后仍在运行
+func (v *verifier) checkPods() (string, error) {
+	if v.podsErr != nil {
+		return fmt.Sprintf("pods before the conversion are unknown: %v", v.podsErr), errSkipped
+	}
+	pods, err := listPods(v.endpoint())
+	if err != nil {
+		return "", err
+	}
+	missing := missingPods(v.pods, pods)
+	if len(missing) > 0 {
+		return "", fmt.Errorf("pods are not running after the conversion: %s", strings.Join(missing, ","))
+	}
+	return fmt.Sprintf("%d pods are running", len(pods)), nil
+}
+
+// endpoint kubelet使用的CRI地址
+func (v *verifier) endpoint() string {
+	if e, ok := flagValue(v.args, "--container-runtime-endpoint"); ok {
+		return e
+	}
+	if v.config.ContainerRuntimeEndpoint != "" {
+		return v.config.ContainerRuntimeEndpoint
+	}
+	if v.runtime == "docker" {
+		return "unix:///var/run/dockershim.sock"
+	}
+	return "unix:///run/containerd/containerd.sock"
+}
+
+// listPods 通过crictl查询CRI中的pod
+func listPods(endpoint string) ([]criPod, error) {
+	if _, err := exec.LookPath("crictl"); err != nil {
+		return nil, errors.New("crictl not found")
+	}
+	out, err := global.Command.ExecuteCommandWithOutput("crictl", "--runtime-endpoint", endpoint, "pods", "-o", "json")
+	if err != nil {
+		return nil, err
+	}
+	return parsePods([]byte(out))
+}
+
+func parsePods(b []byte) ([]criPod, error) {
+	var result struct {
+		Items []struct {
+			Metadata struct {
+				Name      string `json:"name"`
+				Namespace string `json:"namespace"`
+			} `json:"metadata"`
+			State string `json:"state"`
+		} `json:"items"`
+	}
+	if err := json.Unmarshal(b, &result); err != nil {
+		return nil, err
+	}
+	pods := []criPod{}
+	for _, item := range result.Items {
+		pods = append(pods, criPod{
+			Namespace: item.Metadata.Namespace,
+			Name:      item.Metadata.Name,
+			Ready:     item.State == "SANDBOX_READY",
+		})
+	}
+	return pods, nil
+}
+
+// missingPods 转换前运行、转换后没有运行的pod
+func missingPods(before, after []criPod) []string {
+	ready := map[string]bool{}
+	for _, p := range after {
+		if p.Ready {
+			ready[p.Namespace+"/"+p.Name] = true
+		}
+	}
+	missing := []string{}
+	for _, p := range before {
+		if p.Ready && !ready[p.Namespace+"/"+p.Name] {
+			missing = append(missing, p.Namespace+"/"+p.Name)
+		}
+	}
+	return missing
+}
+
+// staticPods 读取静态pod目录中的pod名称
+func staticPods(dir string) ([]criPod, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	pods := []criPod{}
+	for _, e := range entries {
+		ext := path.Ext(e.Name())
+		if e.IsDir() || (ext != ".yaml" && ext != ".yml" && ext != ".json") {
+			continue
+		}
+		b, err := os.ReadFile(path.Join(dir, e.Name()))
+		if err != nil {
+			return nil, err
+		}
+		var manifest struct {
+			Metadata struct {
+				Name      string `yaml:"name"`
+				Namespace string `yaml:"namespace"`
+			} `yaml:"metadata"`
+		}
+		if err = yaml.Unmarshal(b, &manifest); err != nil || manifest.Metadata.Name == "" {
+			continue
+		}
+		if manifest.Metadata.Namespace == "" {
+			manifest.Metadata.Namespace = "default"
+		}
+		pods = append(pods, criPod{Namespace: manifest.Metadata.Namespace, Name: manifest.Metadata.Name})
+	}
+	return pods, nil
+}
+
+// flagValue 读取--flag=value或--flag value形式的参数
+func flagValue(args []string, flag string) (string, bool) {
+	for i, arg := range args {
+		if strings.HasPrefix(arg, flag+"=") {
+			return strings.TrimPrefix(arg, flag+"="), true
+		}
+		if arg == flag && i+1 < len(args) {
+			return args[i+1], true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,118 @@
+package kubelet
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"reflect"
+	"testing"
+)
+
+// TestHealthzURL 验证healthz地址优先使用命令行参数，其次使用配置文件
+func TestHealthzURL(t *testing.T) {
+	port := 10250
+	tests := []struct {
+		args   []string
+		config kubeletConfig
+		want   string
+	}{
+		{nil, kubeletConfig{}, "http://127.0.0.1:10248/healthz"},
+		{nil, kubeletConfig{HealthzPort: &port, HealthzBindAddress: "10.0.0.1"}, "http://10.0.0.1:10250/healthz"},
+		{[]string{"--healthz-port", "10258", "--healthz-bind-address=::"}, kubeletConfig{HealthzPort: &port}, "http://[::1]:10258/healthz"},
+	}
+	for _, tt := range tests {
+		v := &verifier{args: tt.args, config: tt.config}
+		if got := v.healthzURL(); got != tt.want {
+			t.Errorf("healthzURL(%v) = %s, want %s", tt.args, got, tt.want)
+		}
+	}
+}
+
+// TestCheckHealthz 验证healthz返回非ok时检查失败
+func TestCheckHealthz(t *testing.T) {
+	healthy := true
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !healthy {
+			w.WriteHeader(http.StatusInternalServerError)
+			_, _ = w.Write([]byte("[-]syncloop failed"))
+			return
+		}
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	if _, err := checkHealthz(server.URL + "/healthz"); err != nil {
+		t.Error(err)
+	}
+	healthy = false
+	if _, err := checkHealthz(server.URL + "/healthz"); err == nil {
+		t.Error("expected error for an unhealthy kubelet")
+	}
+}
+
+// TestMissingPods 验证转换前就绪、转换后不再就绪的pod被找出
+func TestMissingPods(t *testing.T) {
+	before, err := parsePods([]byte(`{"items":[
+		{"metadata":{"name":"kube-proxy-x","namespace":"kube-system"},"state":"SANDBOX_READY"},
+		{"metadata":{"name":"app-1","namespace":"default"},"state":"SANDBOX_READY"},
+		{"metadata":{"name":"job-1","namespace":"default"},"state":"SANDBOX_NOTREADY"}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	after := []criPod{
+		{Namespace: "kube-system", Name: "kube-proxy-x", Ready: true},
+		{Namespace: "default", Name: "app-1", Ready: false},
+	}
+	if got, want := missingPods(before, after), []string{"default/app-1"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("missingPods = %v, want %v", got, want)
+	}
+}
+
+// TestStaticPods 验证读取静态pod目录中的pod名称和命名空间
+func TestStaticPods(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"etcd.yaml":  "apiVersion: v1\nkind: Pod\nmetadata:\n  name: etcd\n  namespace: kube-system\n",
+		"nginx.json": `{"apiVersion":"v1","kind":"Pod","metadata":{"name":"nginx"}}`,
+		"README.md":  "not a manifest",
+		"broken.yml": "metadata: [",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(path.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	pods, err := staticPods(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []criPod{{Namespace: "kube-system", Name: "etcd"}, {Namespace: "default", Name: "nginx"}}
+	if !reflect.DeepEqual(pods, want) {
+		t.Errorf("staticPods = %+v, want %+v", pods, want)
+	}
+}
+
+// TestNewVerifier 验证在写入unit文件前即可从生成的内容中解析kubelet参数和配置文件
+func TestNewVerifier(t *testing.T) {
+	dir := t.TempDir()
+	config := path.Join(dir, "config.yaml")
+	if err := os.WriteFile(config, []byte("healthzPort: 10258\nstaticPodPath: /etc/kubernetes/manifests\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	unit := "[Service]\nExecStart=/usr/bin/kubelet --config " + config + " \"--node-labels=a=b c\"\nRestart=always\n"
+	v, err := newVerifier(&Options{Runtime: "docker", KubeVersion: "1.21.13"}, unit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"--config", config, "--node-labels=a=b c"}; !reflect.DeepEqual(v.args, want) {
+		t.Errorf("args = %q, want %q", v.args, want)
+	}
+	if v.config.HealthzPort == nil || *v.config.HealthzPort != 10258 {
+		t.Errorf("healthzPort = %v, want 10258", v.config.HealthzPort)
+	}
+
+	if _, err = newVerifier(&Options{}, "ExecStart=/usr/bin/kubelet \"--unterminated\n"); err == nil {
+		t.Error("newVerifier() with an invalid ExecStart succeeded")
+	}
+}
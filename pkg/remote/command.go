@@ -1,7 +1,9 @@
 package remote
 
 import (
+	"regexp"
 	"strings"
+	"time"
 )
 
 type Commands []string
@@ -14,6 +16,10 @@ type File struct {
 type Command struct {
 	Cmds   Commands `json:"cmds,omitempty"`
 	FileUp []File   `json:"fileUp,omitempty"`
+	// timeout of each command, 0 means no timeout
+	Timeout time.Duration `json:"timeout,omitempty"`
+	// progress of the uploads, called from the goroutines of the hosts
+	Progress ProgressFunc `json:"-"`
 }
 
 func (c Command) String() string {
@@ -23,3 +29,14 @@ func (c Command) String() string {
 func (c Command) List() []string {
 	return c.Cmds
 }
+
+// safeWord matches arguments that need no quoting in a POSIX shell
+var safeWord = regexp.MustCompile(`^[A-Za-z0-9_@%+=:,./-]+$`)
+
+// Quote quotes s as a single argument of a POSIX shell command line
+func Quote(s string) string {
+	if safeWord.MatchString(s) {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
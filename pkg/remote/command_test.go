@@ -0,0 +1,33 @@
+package remote
+
+import (
+	"os/exec"
+	"testing"
+)
+
+// TestQuote 验证转义后的参数经shell解析后与原参数一致
+func TestQuote(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh not found")
+	}
+	for _, s := range []string{
+		"",
+		"1.21.13",
+		"http://10.0.0.1:40080/files/",
+		"local=/opt/kubelet dir",
+		"it's",
+		"'; touch /tmp/pwned; '",
+		"$(id) `id` $HOME \\ \" * ?",
+	} {
+		out, err := exec.Command("sh", "-c", "printf %s "+Quote(s)).Output()
+		if err != nil {
+			t.Fatalf("Quote(%q): %v", s, err)
+		}
+		if string(out) != s {
+			t.Errorf("Quote(%q) = %s, shell parsed %q", s, Quote(s), out)
+		}
+	}
+	if got := Quote("1.21.13"); got != "1.21.13" {
+		t.Errorf("Quote(1.21.13) = %s, want it unquoted", got)
+	}
+}
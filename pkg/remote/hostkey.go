@@ -0,0 +1,129 @@
+package remote
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path"
+	"sync"
+
+	gossh "golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// host key check policies
+const (
+	// HostKeyStrict only accepts hosts listed in the known_hosts files
+	HostKeyStrict = "strict"
+	// HostKeyTOFU records the key of an unknown host to the managed known_hosts file on first use
+	HostKeyTOFU = "tofu"
+	// HostKeyInsecure accepts any host key
+	HostKeyInsecure = "insecure"
+)
+
+// HostKeyConfig how the host keys of the remote hosts are verified
+type HostKeyConfig struct {
+	Policy string
+	// known_hosts files to read, missing files are ignored
+	KnownHostsFiles []string
+	// transform-managed known_hosts file, read like the others and written in TOFU mode
+	ManagedFile string
+}
+
+// HostKeys is the host key config used by all the remote clients
+var HostKeys = HostKeyConfig{
+	Policy:          HostKeyStrict,
+	KnownHostsFiles: defaultKnownHosts(),
+}
+
+// HostKeyError the host key of the remote host can not be trusted
+type HostKeyError struct {
+	Host        string
+	Fingerprint string
+	Reason      string
+}
+
+func (e *HostKeyError) Error() string {
+	return fmt.Sprintf("host key verification failed for %s (%s): %s", e.Host, e.Fingerprint, e.Reason)
+}
+
+var managedFileLock sync.Mutex
+
+func defaultKnownHosts() []string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return nil
+	}
+	return []string{path.Join(home, ".ssh", "known_hosts")}
+}
+
+// hostKeyCallback verifies the host key with the pinned fingerprint first, then the known_hosts files
+func (c HostKeyConfig) hostKeyCallback(fingerprint string) gossh.HostKeyCallback {
+	return func(hostname string, remote net.Addr, key gossh.PublicKey) error {
+		actual := gossh.FingerprintSHA256(key)
+		if fingerprint != "" {
+			if actual != fingerprint {
+				return &HostKeyError{Host: hostname, Fingerprint: actual, Reason: fmt.Sprintf("does not match the pinned fingerprint %s", fingerprint)}
+			}
+			return nil
+		}
+		if c.Policy == HostKeyInsecure {
+			return nil
+		}
+
+		err := c.checkKnownHosts(hostname, remote, key)
+		var keyErr *knownhosts.KeyError
+		switch {
+		case err == nil:
+			return nil
+		case errors.As(err, &keyErr) && len(keyErr.Want) > 0:
+			return &HostKeyError{Host: hostname, Fingerprint: actual, Reason: "does not match the key in known_hosts, the host may be impersonated"}
+		case errors.As(err, &keyErr) && c.Policy == HostKeyTOFU:
+			return c.record(hostname, key)
+		case errors.As(err, &keyErr):
+			return &HostKeyError{Host: hostname, Fingerprint: actual, Reason: "unknown host, add it to known_hosts, pin hostKeyFingerprint or use tofu"}
+		}
+		return err
+	}
+}
+
+func (c HostKeyConfig) checkKnownHosts(hostname string, remote net.Addr, key gossh.PublicKey) error {
+	files := []string{}
+	for _, f := range append(append([]string{}, c.KnownHostsFiles...), c.ManagedFile) {
+		if f != "" {
+			if _, err := os.Stat(f); err == nil {
+				files = append(files, f)
+			}
+		}
+	}
+	if len(files) == 0 {
+		return &knownhosts.KeyError{}
+	}
+	managedFileLock.Lock()
+	callback, err := knownhosts.New(files...)
+	managedFileLock.Unlock()
+	if err != nil {
+		return err
+	}
+	return callback(hostname, remote, key)
+}
+
+// record appends the key of a new host to the managed known_hosts file
+func (c HostKeyConfig) record(hostname string, key gossh.PublicKey) error {
+	if c.ManagedFile == "" {
+		return &HostKeyError{Host: hostname, Fingerprint: gossh.FingerprintSHA256(key), Reason: "no managed known_hosts file to record the new key"}
+	}
+	managedFileLock.Lock()
+	defer managedFileLock.Unlock()
+	if err := os.MkdirAll(path.Dir(c.ManagedFile), 0700); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(c.ManagedFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = f.WriteString(knownhosts.Line([]string{knownhosts.Normalize(hostname)}, key) + "\n")
+	return err
+}
@@ -0,0 +1,239 @@
+package remote
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"transform/pkg/configuration"
+)
+
+// aliveTimeout 检查连接是否可用时等待服务端响应的时间
+const aliveTimeout = 10 * time.Second
+
+// uploadRetries 上传失败后的重试次数，每次重试前等待的时间从uploadBackoff开始翻倍
+const uploadRetries = 3
+
+var uploadBackoff = 5 * time.Second
+
+// Pool 按主机IP复用远程客户端，连接断开后在下次使用时重新连接
+type Pool struct {
+	mu      sync.Mutex
+	clients map[string]*pooled
+	// 保活请求的发送间隔，0表示不发送
+	keepalive time.Duration
+}
+
+type pooled struct {
+	mu   sync.Mutex
+	cli  *Cli
+	stop chan struct{}
+}
+
+// NewPool new pool, keepalive requests are sent to every client at the interval when it is greater than 0
+func NewPool(keepalive time.Duration) *Pool {
+	return &Pool{
+		clients:   map[string]*pooled{},
+		keepalive: keepalive,
+	}
+}
+
+func (p *Pool) entry(ip string) *pooled {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	e, ok := p.clients[ip]
+	if !ok {
+		e = &pooled{}
+		p.clients[ip] = e
+	}
+	return e
+}
+
+// Get returns the client of the host, a new client is connected when there is none or the old one is broken
+func (p *Pool) Get(h configuration.Host) (*Cli, error) {
+	e := p.entry(h.IP)
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.cli != nil {
+		if e.cli.Alive() {
+			return e.cli, nil
+		}
+		log.Println(fmt.Sprintf("Connection to %q is broken, reconnecting", h.IP))
+		e.close()
+	}
+
+	cli, err := NewRemoteClient(&h)
+	if err != nil {
+		return nil, err
+	}
+	e.cli = cli
+	if p.keepalive > 0 {
+		e.stop = make(chan struct{})
+		go keepalive(cli, p.keepalive, e.stop)
+	}
+	return cli, nil
+}
+
+// Close closes the client of the host
+func (p *Pool) Close(ip string) {
+	p.mu.Lock()
+	e, ok := p.clients[ip]
+	delete(p.clients, ip)
+	p.mu.Unlock()
+	if ok {
+		e.mu.Lock()
+		e.close()
+		e.mu.Unlock()
+	}
+}
+
+// CloseAll closes all the clients in the pool
+func (p *Pool) CloseAll() {
+	p.mu.Lock()
+	ips := make([]string, 0, len(p.clients))
+	for ip := range p.clients {
+		ips = append(ips, ip)
+	}
+	p.mu.Unlock()
+	for _, ip := range ips {
+		p.Close(ip)
+	}
+}
+
+func (e *pooled) close() {
+	if e.stop != nil {
+		close(e.stop)
+		e.stop = nil
+	}
+	if e.cli != nil {
+		_ = e.cli.Close()
+		e.cli = nil
+	}
+}
+
+// keepalive 定期发送保活请求，避免空闲连接被中间设备断开
+func keepalive(c *Cli, interval time.Duration, stop chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			if !c.Alive() {
+				return
+			}
+		}
+	}
+}
+
+// Run is the same as the package level Run, but the clients in the pool are used
+func (p *Pool) Run(hosts []configuration.Host, cmd Command) []HostResult {
+	return p.RunWithLimit(hosts, cmd, 0)
+}
+
+// RunWithLimit is the same as the package level RunWithLimit, but the clients in the pool are used
+func (p *Pool) RunWithLimit(hosts []configuration.Host, cmd Command, limit int) []HostResult {
+	if limit <= 0 || limit > len(hosts) {
+		limit = len(hosts)
+	}
+	var (
+		wg      sync.WaitGroup
+		results = make([]HostResult, len(hosts))
+		sem     = make(chan struct{}, limit)
+	)
+	for i, h := range hosts {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, h configuration.Host) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			results[i] = p.run(h, cmd)
+		}(i, h)
+	}
+	wg.Wait()
+	return results
+}
+
+// run Command on the remote host, the client is checked before every step so that a broken connection is reconnected
+func (p *Pool) run(h configuration.Host, cmd Command) (result HostResult) {
+	startTime := time.Now()
+	result.IP = h.IP
+	defer func() {
+		if err := recover(); err != nil {
+			result.fail(ErrorCommand, fmt.Sprintf("%v", err))
+		}
+		result.Duration = time.Now().Sub(startTime)
+	}()
+
+	if _, err := p.Get(h); err != nil {
+		log.Println(fmt.Sprintf("Failed to create remote ssh client: %v", err))
+		result.fail(classify(err, ErrorConnect), err.Error())
+		return result
+	}
+	for _, file := range cmd.FileUp {
+		step := StepResult{Kind: StepUpload, Name: file.Src, Dst: file.Dst}
+		stepStart := time.Now()
+		progress := func(written, total int64) {
+			if cmd.Progress != nil {
+				cmd.Progress(h.IP, file.Src, written, total)
+			}
+		}
+		var err error
+		backoff := uploadBackoff
+		for i := 0; i <= uploadRetries; i++ {
+			if i > 0 {
+				log.Println(fmt.Sprintf("Failed to upload file %q to %q %q, err %s", file.Src, h.IP, file.Dst, err.Error()))
+				log.Println(fmt.Sprintf("Wait %s and try again %d", backoff, i))
+				time.Sleep(backoff)
+				backoff *= 2
+			}
+			var cli *Cli
+			if cli, err = p.Get(h); err != nil {
+				continue
+			}
+			if step.Bytes, step.Checksum, err = cli.UploadFile(file.Src, file.Dst, progress); err == nil {
+				break
+			}
+		}
+		step.Duration = time.Now().Sub(stepStart)
+		if err != nil {
+			step.Err = err.Error()
+			result.fail(ErrorUpload, fmt.Sprintf("%s: %s", stepName(step), step.Err))
+		} else {
+			log.Println(fmt.Sprintf("Upload file %q to %q %q, Success", file.Src, h.IP, file.Dst))
+		}
+		result.Steps = append(result.Steps, step)
+	}
+
+	for _, c := range cmd.List() {
+		cli, err := p.Get(h)
+		if err != nil {
+			log.Println(fmt.Sprintf("Failed to create remote ssh client: %v", err))
+			result.fail(classify(err, ErrorConnect), err.Error())
+			return result
+		}
+		step := StepResult{Kind: StepCommand, Name: c}
+		exec, err := cli.SSH.ExecTimeout(c, cmd.Timeout)
+		step.ExitCode = exec.ExitCode
+		step.Stdout = exec.Stdout
+		step.Stderr = exec.Stderr
+		step.Duration = exec.Duration
+		switch {
+		case err != nil:
+			log.Println(fmt.Sprintf("Failed to execute command %q on %q, err: %s", c, h.IP, err.Error()))
+			step.Err = err.Error()
+			result.fail(classify(err, ErrorCommand), fmt.Sprintf("%s: %s", stepName(step), step.Err))
+		case step.Failed():
+			log.Println(fmt.Sprintf("Failed to execute command %q on %q, exit code %d, stderr: %s", c, h.IP, step.ExitCode, step.Stderr))
+			result.fail(ErrorCommand, fmt.Sprintf("%s: %s", stepName(step), step.Message()))
+		default:
+			log.Println(fmt.Sprintf("Execute command %q on %q, Success", c, h.IP))
+		}
+		result.Steps = append(result.Steps, step)
+	}
+	return result
+}
@@ -0,0 +1,177 @@
+package remote
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"transform/pkg/configuration"
+)
+
+// TestPool 验证连接被复用，断开后重新连接，关闭时释放连接
+func TestPool(t *testing.T) {
+	server := newTestServer(t, "login-pass")
+	defer func(c HostKeyConfig) { HostKeys = c }(HostKeys)
+	HostKeys = HostKeyConfig{Policy: HostKeyInsecure}
+	host := configuration.Host{IP: server.host, Port: server.port, UserName: "root", Password: "login-pass"}
+
+	pool := NewPool(0)
+	defer pool.CloseAll()
+	cli, err := pool.Get(host)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again, err := pool.Get(host); err != nil || again != cli {
+		t.Errorf("expected the client to be reused, got %p, %v", again, err)
+	}
+
+	// 连接断开后重新连接
+	_ = cli.SSH.sshClient.Close()
+	reconnected, err := pool.Get(host)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reconnected == cli || !reconnected.Alive() {
+		t.Error("expected a new client after the connection is broken")
+	}
+
+	if results := pool.Run([]configuration.Host{host}, Command{Cmds: []string{"hostname"}}); results[0].Failed() {
+		t.Errorf("Run = %+v", results)
+	}
+	if again, _ := pool.Get(host); again != reconnected {
+		t.Error("expected Run to use the pooled client")
+	}
+
+	pool.CloseAll()
+	if reconnected.Alive() {
+		t.Error("client is still alive after the pool is closed")
+	}
+}
+
+// TestRunResult 验证每个步骤的结果，以及失败的分类和原因
+func TestRunResult(t *testing.T) {
+	server := newTestServer(t, "login-pass")
+	defer func(c HostKeyConfig) { HostKeys = c }(HostKeys)
+	HostKeys = HostKeyConfig{Policy: HostKeyInsecure}
+	host := configuration.Host{IP: server.host, Port: server.port, UserName: "root", Password: "login-pass"}
+
+	src := path.Join(t.TempDir(), "transform")
+	if err := os.WriteFile(src, []byte("binary"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	dst := t.TempDir()
+	results := Run([]configuration.Host{host}, Command{
+		FileUp: []File{{Src: src, Dst: dst}},
+		Cmds:   []string{"hostname", "exit 2", "uname"},
+	})
+	if len(results) != 1 || len(results[0].Steps) != 4 {
+		t.Fatalf("Run = %+v", results)
+	}
+	r := results[0]
+	upload := r.Steps[0]
+	if upload.Kind != StepUpload || upload.Bytes != 6 || upload.Checksum != sha256Hex("binary") {
+		t.Errorf("upload = %+v", upload)
+	}
+	if b, err := os.ReadFile(path.Join(dst, "transform")); err != nil || string(b) != "binary" {
+		t.Errorf("uploaded file = %q, %v", b, err)
+	}
+	if r.Steps[2].ExitCode != 2 || r.Steps[3].Failed() {
+		t.Errorf("steps = %+v", r.Steps)
+	}
+	if r.ErrorClass != ErrorCommand || r.Err != `command "exit 2": exit 2` {
+		t.Errorf("ErrorClass = %s, Err = %s", r.ErrorClass, r.Err)
+	}
+
+	// 主机公钥不可信时分类为hostkey
+	HostKeys = HostKeyConfig{Policy: HostKeyStrict}
+	results = Run([]configuration.Host{host}, Command{Cmds: []string{"hostname"}})
+	if len(FailedHosts(results)) != 1 || results[0].ErrorClass != ErrorHostKey {
+		t.Errorf("expected hostkey error, got %+v", results)
+	}
+}
+
+func sha256Hex(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+// TestUploadResume 验证从已上传的位置继续上传，已上传部分损坏时重新上传
+func TestUploadResume(t *testing.T) {
+	server := newTestServer(t, "login-pass")
+	defer func(c HostKeyConfig) { HostKeys = c }(HostKeys)
+	HostKeys = HostKeyConfig{Policy: HostKeyInsecure}
+	defer func(d time.Duration) { uploadBackoff = d }(uploadBackoff)
+	uploadBackoff = time.Millisecond
+	host := configuration.Host{IP: server.host, Port: server.port, UserName: "root", Password: "login-pass"}
+
+	content := strings.Repeat("kubelet", uploadChunk/4)
+	src := path.Join(t.TempDir(), "kubelet")
+	if err := os.WriteFile(src, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	total := int64(len(content))
+	tests := []struct {
+		name string
+		part string
+		// 第一次报告的进度
+		from int64
+		// 第一次上传因为校验不一致失败
+		retried bool
+	}{
+		{"no part", "", 0, false},
+		{"resume", content[:100], 100, false},
+		{"corrupted part", "corrupted", 9, true},
+		{"part larger than the file", content + "tail", 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dst := t.TempDir()
+			if tt.part != "" {
+				if err := os.WriteFile(path.Join(dst, "kubelet"+partSuffix), []byte(tt.part), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			var mu sync.Mutex
+			progress := []int64{}
+			results := Run([]configuration.Host{host}, Command{
+				FileUp: []File{{Src: src, Dst: dst}},
+				Progress: func(host, file string, written, t int64) {
+					mu.Lock()
+					defer mu.Unlock()
+					if t == total {
+						progress = append(progress, written)
+					}
+				},
+			})
+			if results[0].Failed() {
+				t.Fatalf("Run = %+v", results[0])
+			}
+			if progress[0] != tt.from || progress[len(progress)-1] != total {
+				t.Errorf("progress = %v, want from %d to %d", progress, tt.from, total)
+			}
+			if retried := contains(progress[1:], 0); retried != tt.retried {
+				t.Errorf("retried = %v, want %v, progress %v", retried, tt.retried, progress)
+			}
+			if b, err := os.ReadFile(path.Join(dst, "kubelet")); err != nil || string(b) != content {
+				t.Errorf("uploaded file is not the same, %v", err)
+			}
+			if _, err := os.Stat(path.Join(dst, "kubelet"+partSuffix)); !os.IsNotExist(err) {
+				t.Errorf("part file is not removed: %v", err)
+			}
+		})
+	}
+}
+
+func contains(values []int64, v int64) bool {
+	for _, value := range values {
+		if value == v {
+			return true
+		}
+	}
+	return false
+}
@@ -4,110 +4,39 @@ import (
 	"errors"
 	"fmt"
 	"io"
-	"log"
+	"time"
 	"transform/pkg/configuration"
 )
 
 type Cli struct {
 	User     string
 	Password string
-	SSHKey   interface{}
-	Address  string
-	Port     string
-	SSH      *ssh
-	SFTP     *sftp
+	SSHKey   SSHKey
+	// pinned SHA256 fingerprint of the host key
+	HostKeyFingerprint string
+	Address            string
+	Port               string
+	SSH                *ssh
+	SFTP               *sftp
 }
 
-func (c Cli) Fields() (string, string, string, string, interface{}) {
-	return c.User, c.Password, c.Address, c.Port, c.SSHKey
+func (c Cli) Fields() (string, string, string, string, SSHKey, string) {
+	return c.User, c.Password, c.Address, c.Port, c.SSHKey, c.HostKeyFingerprint
 }
 
-// Run supports executing commands and uploading files on the remote hosts
-// return a map contains the standard stderr,and the map key is remote host ip
-func Run(hosts []configuration.Host, cmd Command) map[string][]string {
-	if len(hosts) == 0 {
-		return map[string][]string{}
-	}
-	stopChan := make(chan bool)
-	stderrsChan := make(chan map[string][]string)
-	stderrs := make(map[string][]string)
-
-	q := 0
-
-	for _, h := range hosts {
-		go run(h, cmd, stopChan, stderrsChan)
-	}
-
-	for {
-		select {
-		case _ = <-stopChan:
-			if q += 1; q == len(hosts) {
-				return stderrs
-			}
-		case stderrsMap := <-stderrsChan:
-			for host := range stderrsMap {
-				stderrs[host] = append(stderrs[host], stderrsMap[host]...)
-			}
-		}
-	}
+// Run supports executing commands and uploading files on the remote hosts,
+// return the result of every host in the same order as the hosts
+func Run(hosts []configuration.Host, cmd Command) []HostResult {
+	return RunWithLimit(hosts, cmd, 0)
 }
 
-// run Command on the remote hosts
-func run(h configuration.Host, cmd Command, stopChan chan bool, stderrsChan chan map[string][]string) {
-	stderrs := make(map[string][]string)
-	RemoteClient, err := NewRemoteClient(&h)
-
-	if err != nil || RemoteClient == nil {
-		log.Println(fmt.Sprintf("Failed to create remote ssh client: %v", err))
-		stderrs[h.IP] = append(stderrs[h.IP], err.Error())
-		stderrsChan <- stderrs
-		stopChan <- true
-		return
-	}
-
-	defer func() {
-		_ = RemoteClient.CloseRemoteCli(stopChan)
-		if err := recover(); err != nil {
-			stderrs[h.IP] = append(stderrs[h.IP], fmt.Sprintf("%v", err))
-		}
-		stderrsChan <- stderrs
-	}()
-
-	for _, file := range cmd.FileUp {
-		if err := RemoteClient.SFTP.UploadFile(file.Src, file.Dst); err != nil {
-			log.Println(fmt.Sprintf("Failed to upload file %q to %q %q, err %s", file.Src, h.IP, file.Dst, err.Error()))
-			for i := 0; i < 3; i++ {
-				log.Println(fmt.Sprintf("Wiat 10 seconds and try again %d", i+1))
-				err = RemoteClient.SFTP.UploadFile(file.Src, file.Dst)
-				if err == nil {
-					break
-				}
-			}
-			if err != nil {
-				stderrs[h.IP] = append(stderrs[h.IP], err.Error())
-				stderrsChan <- stderrs
-			}
-			continue
-		}
-		log.Println(fmt.Sprintf("Upload file %q to %q %q, Success", file.Src, h.IP, file.Dst))
-	}
-
-	for _, c := range cmd.List() {
-		_, stderr, err := RemoteClient.SSH.Exec(c)
-		if len(stderr) != 0 {
-			log.Println(fmt.Sprintf("Failed to execute command %q on %q, stderr: %s", c, h.IP, stderr))
-			stderrs[h.IP] = append(stderrs[h.IP], stderr...)
-			stderrsChan <- stderrs
-		}
-		if err != nil {
-			log.Println(fmt.Sprintf("Failed to execute command %q on %q, err: %s", c, h.IP, err.Error()))
-			stderrs[h.IP] = append(stderrs[h.IP], err.Error())
-			stderrsChan <- stderrs
-		}
-		if len(stderr) == 0 && err == nil {
-			log.Println(fmt.Sprintf("Execute command %q on %q, Success", c, h.IP))
-		}
-	}
+// RunWithLimit is the same as Run, but at most limit hosts are executed at the same time,
+// limit <= 0 means no limit. The connections are closed when the command is done,
+// use a Pool to reuse them
+func RunWithLimit(hosts []configuration.Host, cmd Command, limit int) []HostResult {
+	pool := NewPool(0)
+	defer pool.CloseAll()
+	return pool.RunWithLimit(hosts, cmd, limit)
 }
 
 // NewRemoteClient returns a new remote client with ssh and sftp client
@@ -122,29 +51,80 @@ func NewRemoteClient(h *configuration.Host) (*Cli, error) {
 	c := &Cli{
 		User:     h.UserName,
 		Password: h.Password,
-		SSHKey:   "",
-		Address:  h.IP,
-		Port:     h.Port,
+		SSHKey: SSHKey{
+			PrivateKeyFile: h.PrivateKeyFile,
+			Passphrase:     h.PrivateKeyPassphrase,
+			Agent:          h.SSHAgent,
+		},
+		Address:            h.IP,
+		Port:               h.Port,
+		HostKeyFingerprint: h.HostKeyFingerprint,
 	}
 
-	c.SSH, err = NewSSHClient(c.Fields())
-	if err != nil {
-		return nil, errors.New(fmt.Sprintf(err.Error(), "Failed to create ssh client"))
+	if j := h.Jump(); j != nil {
+		port := j.Port
+		if port == "" {
+			port = "22"
+		}
+		jump, err := NewSSHClient(j.UserName, j.Password, j.IP, port, SSHKey{
+			PrivateKeyFile: j.PrivateKeyFile,
+			Passphrase:     j.PrivateKeyPassphrase,
+			Agent:          j.SSHAgent,
+		}, j.HostKeyFingerprint)
+		if err != nil {
+			return nil, fmt.Errorf("failed to connect to jump host %s: %w", j.IP, err)
+		}
+		c.SSH, err = NewSSHClientThrough(jump, c.User, c.Password, c.Address, c.Port, c.SSHKey, c.HostKeyFingerprint)
+		if err != nil {
+			_ = jump.Close()
+			return nil, fmt.Errorf("failed to create ssh client: %w", err)
+		}
+	} else {
+		c.SSH, err = NewSSHClient(c.Fields())
+		if err != nil {
+			return nil, fmt.Errorf("failed to create ssh client: %w", err)
+		}
 	}
 
+	c.SSH.SetSudo(Sudo{Password: h.SudoPassword, Become: h.Become})
+
 	c.SFTP, err = NewSFTPClient(c.SSH.sshClient)
 	if err != nil {
+		_ = c.SSH.Close()
 		return nil, err
 	}
 
 	return c, nil
 }
 
-// CloseRemoteCli 关闭远程客户端
-func (c *Cli) CloseRemoteCli(stopChan chan bool) error {
-	if err := c.SFTP.sftpClient.Close(); err != nil && err != io.EOF {
-		return errors.New("failed to close sftp client")
+// Close closes the sftp client and the ssh connection
+func (c *Cli) Close() error {
+	var err error
+	if c.SFTP != nil {
+		if e := c.SFTP.sftpClient.Close(); e != nil && e != io.EOF {
+			err = errors.New("failed to close sftp client")
+		}
+	}
+	if c.SSH != nil {
+		_ = c.SSH.Close()
+	}
+	return err
+}
+
+// Alive whether the ssh connection still responds
+func (c *Cli) Alive() bool {
+	if c.SSH == nil || c.SSH.sshClient == nil {
+		return false
+	}
+	done := make(chan error, 1)
+	go func() {
+		_, _, err := c.SSH.sshClient.SendRequest("keepalive@openssh.com", true, nil)
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		return err == nil
+	case <-time.After(aliveTimeout):
+		return false
 	}
-	stopChan <- true
-	return nil
 }
@@ -0,0 +1,120 @@
+package remote
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// error classes of a failed host
+const (
+	// ErrorConnect the ssh or sftp connection can not be established
+	ErrorConnect = "connect"
+	// ErrorHostKey the host key can not be trusted
+	ErrorHostKey = "hostkey"
+	// ErrorSudo sudo can not be used on the host
+	ErrorSudo = "sudo"
+	// ErrorUpload a file can not be uploaded
+	ErrorUpload = "upload"
+	// ErrorCommand a command exits with a non-zero code or can not be executed
+	ErrorCommand = "command"
+	// ErrorTimeout a command does not finish in time
+	ErrorTimeout = "timeout"
+)
+
+// kinds of the steps
+const (
+	StepUpload  = "upload"
+	StepCommand = "command"
+)
+
+// StepResult 一次文件上传或命令执行的结果
+type StepResult struct {
+	Kind string
+	// 上传的本地文件或执行的命令
+	Name string
+	// 上传的远程目录
+	Dst string
+	// 上传的字节数和文件的sha256
+	Bytes    int64
+	Checksum string
+	ExitCode int
+	Stdout   []string
+	Stderr   []string
+	Duration time.Duration
+	// 上传或执行失败的原因，不包括非0的退出码
+	Err string
+}
+
+// Failed whether the step failed
+func (s StepResult) Failed() bool {
+	return s.Err != "" || s.ExitCode != 0
+}
+
+// Message describes why the step failed
+func (s StepResult) Message() string {
+	if s.Err != "" {
+		return s.Err
+	}
+	return (&ExecResult{Stderr: s.Stderr, ExitCode: s.ExitCode}).Message()
+}
+
+// HostResult 在一个主机上执行Command的结果
+type HostResult struct {
+	IP    string
+	Steps []StepResult
+	// 第一个失败的分类，成功时为空
+	ErrorClass string
+	// 第一个失败的原因
+	Err      string
+	Duration time.Duration
+}
+
+// Failed whether anything failed on the host
+func (r HostResult) Failed() bool {
+	return r.ErrorClass != ""
+}
+
+// fail records the first failure of the host
+func (r *HostResult) fail(class, message string) {
+	if r.ErrorClass == "" {
+		r.ErrorClass = class
+		r.Err = message
+	}
+}
+
+// FailedHosts returns the results of the hosts where anything failed
+func FailedHosts(results []HostResult) []HostResult {
+	failed := []HostResult{}
+	for _, r := range results {
+		if r.Failed() {
+			failed = append(failed, r)
+		}
+	}
+	return failed
+}
+
+// classify 按错误类型分类，其余错误按默认分类
+func classify(err error, class string) string {
+	var (
+		hostKeyErr *HostKeyError
+		sudoErr    *SudoError
+	)
+	switch {
+	case errors.As(err, &hostKeyErr):
+		return ErrorHostKey
+	case errors.As(err, &sudoErr):
+		return ErrorSudo
+	case errors.Is(err, context.DeadlineExceeded):
+		return ErrorTimeout
+	}
+	return class
+}
+
+func stepName(step StepResult) string {
+	if step.Kind == StepUpload {
+		return fmt.Sprintf("upload %s to %s", step.Name, step.Dst)
+	}
+	return fmt.Sprintf("command %q", step.Name)
+}
@@ -1,9 +1,10 @@
 package remote
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"io"
 	"os"
-	"path"
 
 	"github.com/pkg/errors"
 	gosftp "github.com/pkg/sftp"
@@ -25,53 +26,83 @@ func NewSFTPClient(sshClient *gossh.Client) (*sftp, error) {
 	}, nil
 }
 
-func (s *sftp) UploadFile(localFilePath string, remoteDirPath string) error {
+// uploadChunk 每次写入远程文件的大小，每写完一块报告一次进度
+const uploadChunk = 1 << 20
+
+// UploadFile 上传本地文件到远程文件，远程文件已有的部分不再上传，
+// 返回本地文件的大小和sha256。已有部分是否完整需要由调用方校验
+func (s *sftp) UploadFile(localFilePath string, remoteFilePath string, progress func(written, total int64)) (int64, string, error) {
 	if s.sftpClient == nil {
-		return errors.New("Before run, have to new a sftp client")
+		return 0, "", errors.New("Before run, have to new a sftp client")
 	}
 
 	// 打开本地文件
 	localFile, err := os.Open(localFilePath)
+	if err != nil {
+		return 0, "", errors.Wrap(err, "Failed to open local file")
+	}
 	defer localFile.Close()
+	localFileStat, err := localFile.Stat()
 	if err != nil {
-		return errors.Wrap(err, "Failed to open local file")
+		return 0, "", err
 	}
-
-	// 创建远程文件
-	remoteFileName := path.Base(localFilePath)
-	remoteFilePath := path.Join(remoteDirPath, remoteFileName)
-
-	// 有时因为远程文件已经存在，s.sftpClient.Create会报错，所以默认先删除在重新创建。
-	_ = s.sftpClient.Remove(remoteFilePath)
-
-	remoteFile, err := s.sftpClient.Create(remoteFilePath)
+	size := localFileStat.Size()
+
+	// 远程文件比本地文件大时说明不是同一个文件，重新上传
+	flags := os.O_WRONLY | os.O_CREATE
+	offset := int64(0)
+	if remoteFileStat, err := s.sftpClient.Stat(remoteFilePath); err == nil && remoteFileStat.Size() <= size {
+		offset = remoteFileStat.Size()
+	} else {
+		flags |= os.O_TRUNC
+	}
+	remoteFile, err := s.sftpClient.OpenFile(remoteFilePath, flags)
 	if err != nil {
-		return errors.Wrap(err, "Failed to create remote file")
+		return 0, "", errors.Wrap(err, "Failed to create remote file")
 	}
 	defer remoteFile.Close()
 
-	// 用io.Copy的方式上传文件，速度更快
-	_, err = io.Copy(remoteFile, localFile)
-	if err != nil {
-		return errors.Wrap(err, "Failed to copy local file to remote file")
+	// 已上传的部分只计算校验值
+	hash := sha256.New()
+	if _, err = io.CopyN(hash, localFile, offset); err != nil {
+		return 0, "", errors.Wrap(err, "Failed to read local file")
 	}
-
-	remoteFileStat, err := remoteFile.Stat()
-	if err != nil {
-		return err
+	if _, err = remoteFile.Seek(offset, io.SeekStart); err != nil {
+		return 0, "", errors.Wrap(err, "Failed to seek remote file")
 	}
-	localFileStat, err := localFile.Stat()
-	if err != nil {
-		return err
+	written := offset
+	if progress != nil {
+		progress(written, size)
 	}
-
-	if remoteFileStat.Size() != localFileStat.Size() {
-		if err := s.sftpClient.Remove(path.Join(remoteDirPath, remoteFileName)); err != nil {
-			return errors.Wrap(err, "Failed to remove damaged file")
+	for written < size {
+		chunk := size - written
+		if chunk > uploadChunk {
+			chunk = uploadChunk
+		}
+		n, err := io.CopyN(remoteFile, io.TeeReader(localFile, hash), chunk)
+		written += n
+		if progress != nil {
+			progress(written, size)
+		}
+		if err != nil {
+			return size, "", errors.Wrap(err, "Failed to copy local file to remote file")
 		}
-		return errors.New("Failed to upload file, file size not match")
 	}
-	return nil
+	return size, hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// Rename 重命名远程文件，目标文件已经存在时覆盖
+func (s *sftp) Rename(oldPath, newPath string) error {
+	if err := s.sftpClient.PosixRename(oldPath, newPath); err == nil {
+		return nil
+	}
+	_ = s.sftpClient.Remove(newPath)
+	return s.sftpClient.Rename(oldPath, newPath)
+}
+
+// Remove 删除远程文件
+func (s *sftp) Remove(remoteFilePath string) error {
+	return s.sftpClient.Remove(remoteFilePath)
 }
 
 func (s *sftp) DownloadFile(localFilePath string, remoteDirPath string) error {
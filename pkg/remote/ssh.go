@@ -1,57 +1,152 @@
 package remote
 
 import (
-	"bufio"
+	"context"
 	"errors"
 	"fmt"
 	"io"
 	"net"
+	"os"
+	"strings"
 	"time"
 
 	gossh "golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
 )
 
 type ssh struct {
 	sshClient *gossh.Client
+	user      string
+	password  string
+	sudo      Sudo
+	// the jump host the connection goes through
+	jump *ssh
 }
 
-// NewSSHClient new ssh client
-func NewSSHClient(user string, password string, host string, port string, sshKey interface{}) (*ssh, error) {
-	var (
-		sshClient *gossh.Client
-		err       error
-	)
+// SSHKey public key authentication of the remote host
+type SSHKey struct {
+	PrivateKeyFile string
+	Passphrase     string
+	// use the keys in the ssh-agent listening on SSH_AUTH_SOCK
+	Agent bool
+}
 
-	switch {
-	case user != "" && password != "" && host != "":
-		if sshClient, err = NewNormalSSHClient(user, password, host, port); err != nil {
-			return nil, err
-		}
-		break
-	case sshKey != "":
-		if sshClient, err = NewWithOutPassSSHClient(sshKey); err != nil {
-			return nil, err
-		}
-	default:
+// NewSSHClient new ssh client, the private key and the ssh agent are tried before the password.
+// The host key is verified with the fingerprint if it is pinned, otherwise with HostKeys
+func NewSSHClient(user string, password string, host string, port string, sshKey SSHKey, fingerprint string) (*ssh, error) {
+	return NewSSHClientThrough(nil, user, password, host, port, sshKey, fingerprint)
+}
+
+// NewSSHClientThrough new ssh client that connects to the host through the jump host,
+// the jump host is closed together with the client
+func NewSSHClientThrough(jump *ssh, user string, password string, host string, port string, sshKey SSHKey, fingerprint string) (*ssh, error) {
+	if user == "" || host == "" {
 		return nil, fmt.Errorf("some fields are blank")
 	}
+	auth, closer, err := authMethods(password, sshKey)
+	if err != nil {
+		return nil, err
+	}
+	if closer != nil {
+		defer closer.Close()
+	}
+	if len(auth) == 0 {
+		return nil, fmt.Errorf("no authentication method for %s@%s", user, host)
+	}
 
+	var sshClient *gossh.Client
+	if jump != nil {
+		sshClient, err = dialThrough(jump.sshClient, user, host, port, auth, fingerprint)
+	} else {
+		sshClient, err = dial(user, host, port, auth, fingerprint)
+	}
+	if err != nil {
+		return nil, err
+	}
 	return &ssh{
 		sshClient: sshClient,
+		user:      user,
+		password:  password,
+		jump:      jump,
 	}, nil
 }
 
 // NewNormalSSHClient new ssh client with username and password
 func NewNormalSSHClient(user string, password string, host string, port string) (*gossh.Client, error) {
-	config := &gossh.ClientConfig{
-		User:            user,
-		Auth:            []gossh.AuthMethod{gossh.Password(password)},
-		Timeout:         30 * time.Second,
-		HostKeyCallback: func(hostname string, remote net.Addr, key gossh.PublicKey) error { return nil },
+	return dial(user, host, port, []gossh.AuthMethod{gossh.Password(password)}, "")
+}
+
+// NewWithOutPassSSHClient new ssh client with ssh key
+func NewWithOutPassSSHClient(user string, host string, port string, sshKey SSHKey) (*gossh.Client, error) {
+	auth, closer, err := authMethods("", sshKey)
+	if err != nil {
+		return nil, err
 	}
-	config.SetDefaults()
+	if closer != nil {
+		defer closer.Close()
+	}
+	return dial(user, host, port, auth, "")
+}
 
-	address := fmt.Sprintf("%s:%s", host, port)
+// authMethods builds the authentication chain: private key file, ssh agent, password.
+// The returned closer closes the connection to the ssh agent once the handshake is done
+func authMethods(password string, sshKey SSHKey) ([]gossh.AuthMethod, io.Closer, error) {
+	var (
+		auth   []gossh.AuthMethod
+		closer io.Closer
+	)
+	if sshKey.PrivateKeyFile != "" {
+		signer, err := loadPrivateKey(sshKey.PrivateKeyFile, sshKey.Passphrase)
+		if err != nil {
+			return nil, nil, err
+		}
+		auth = append(auth, gossh.PublicKeys(signer))
+	}
+	if sshKey.Agent {
+		socket := os.Getenv("SSH_AUTH_SOCK")
+		if socket == "" {
+			return nil, nil, errors.New("SSH_AUTH_SOCK is not set, ssh agent is not available")
+		}
+		conn, err := net.Dial("unix", socket)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to connect to ssh agent: %v", err)
+		}
+		auth = append(auth, gossh.PublicKeysCallback(agent.NewClient(conn).Signers))
+		closer = conn
+	}
+	if password != "" {
+		auth = append(auth, gossh.Password(password))
+	}
+	return auth, closer, nil
+}
+
+// loadPrivateKey reads the private key, the passphrase is required for an encrypted key
+func loadPrivateKey(file, passphrase string) (gossh.Signer, error) {
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	if passphrase != "" {
+		signer, err := gossh.ParsePrivateKeyWithPassphrase(b, []byte(passphrase))
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse private key %s: %v", file, err)
+		}
+		return signer, nil
+	}
+	signer, err := gossh.ParsePrivateKey(b)
+	if err != nil {
+		var missing *gossh.PassphraseMissingError
+		if errors.As(err, &missing) {
+			return nil, fmt.Errorf("private key %s is encrypted, privateKeyPassphrase is required", file)
+		}
+		return nil, fmt.Errorf("failed to parse private key %s: %v", file, err)
+	}
+	return signer, nil
+}
+
+func dial(user, host, port string, auth []gossh.AuthMethod, fingerprint string) (*gossh.Client, error) {
+	config := clientConfig(user, auth, fingerprint)
+	address := net.JoinHostPort(host, port)
 
 	client, err := gossh.Dial("tcp", address, config)
 	if err != nil {
@@ -61,75 +156,151 @@ func NewNormalSSHClient(user string, password string, host string, port string)
 	return client, nil
 }
 
-// NewWithOutPassSSHClient new ssh client with ssh key
-func NewWithOutPassSSHClient(sshKey interface{}) (*gossh.Client, error) {
-	return nil, nil
+// dialThrough opens a tcp connection from the jump host to the target and runs the ssh handshake over it
+func dialThrough(jump *gossh.Client, user, host, port string, auth []gossh.AuthMethod, fingerprint string) (*gossh.Client, error) {
+	config := clientConfig(user, auth, fingerprint)
+	address := net.JoinHostPort(host, port)
+
+	conn, err := jump.Dial("tcp", address)
+	if err != nil {
+		return nil, fmt.Errorf("failed to dial %s through the jump host: %v", address, err)
+	}
+	c, chans, reqs, err := gossh.NewClientConn(conn, address, config)
+	if err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	return gossh.NewClient(c, chans, reqs), nil
 }
 
-// Exec	command on remote host
-// just return stderr and error
-func (s *ssh) Exec(cmd string) ([]string, []string, error) {
-	var stderrs []string
-	var result []string
+func clientConfig(user string, auth []gossh.AuthMethod, fingerprint string) *gossh.ClientConfig {
+	config := &gossh.ClientConfig{
+		User:            user,
+		Auth:            auth,
+		Timeout:         30 * time.Second,
+		HostKeyCallback: HostKeys.hostKeyCallback(fingerprint),
+	}
+	config.SetDefaults()
+	return config
+}
 
+// Close closes the connection and the jump host
+func (s *ssh) Close() error {
+	err := s.sshClient.Close()
+	if s.jump != nil {
+		_ = s.jump.Close()
+	}
+	return err
+}
+
+// ExecResult result of a command executed on the remote host
+type ExecResult struct {
+	Stdout []string
+	Stderr []string
+	// stdout and stderr interleaved in the order they were received
+	Output   []string
+	ExitCode int
+	Duration time.Duration
+}
+
+// Success whether the command exited with 0
+func (r *ExecResult) Success() bool {
+	return r.ExitCode == 0
+}
+
+// Message describes a failed command with its stderr, or the exit code when stderr is empty
+func (r *ExecResult) Message() string {
+	if len(r.Stderr) > 0 {
+		return strings.Join(r.Stderr, "\n")
+	}
+	return fmt.Sprintf("exit code %d", r.ExitCode)
+}
+
+// Exec	command on remote host and wait until it exits or the context is done.
+// A non-zero exit code is not an error, it is returned in the result.
+// The error is a *SudoError when sudo can not be used
+func (s *ssh) Exec(ctx context.Context, cmd string) (*ExecResult, error) {
+	result := &ExecResult{Stdout: []string{}, Stderr: []string{}, Output: []string{}}
 	if s.sshClient == nil {
-		return result, stderrs, errors.New("before run, have to new a ssh client")
+		return result, errors.New("before run, have to new a ssh client")
 	}
 
 	// 不执行命令直接返回
 	if cmd == "" {
-		return result, stderrs, nil
+		return result, nil
 	}
 
 	session, err := s.sshClient.NewSession()
 	if err != nil {
-		return result, stderrs, errors.New(fmt.Sprintf(err.Error(), "Create session failed"))
+		return result, fmt.Errorf("create session failed: %v", err)
 	}
-
 	defer session.Close()
 
-	r, _ := session.StdoutPipe()
-	e, _ := session.StderrPipe()
+	stdin, err := session.StdinPipe()
+	if err != nil {
+		return result, err
+	}
+	password := s.sudo.Password
+	if password == "" {
+		password = s.password
+	}
+	output := &output{}
+	stdout := &stream{output: output}
+	stderr := &promptWriter{stdin: stdin, password: password, stream: stream{output: output}}
+	session.Stdout = stdout
+	session.Stderr = stderr
 
+	startTime := time.Now()
+	if err = session.Start(sudoCommand(cmd, s.user, s.sudo)); err != nil {
+		return result, err
+	}
+	done := make(chan error, 1)
 	go func() {
-		if err := session.Run(cmd); err != nil {
-			return
-		}
+		done <- session.Wait()
 	}()
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		_ = session.Signal(gossh.SIGKILL)
+		_ = session.Close()
+		err = ctx.Err()
+	}
+	_ = stdin.Close()
 
-	outReader := bufio.NewReader(r)
-	errReader := bufio.NewReader(e)
-
-	for {
-		if res, err := s.readPipe(outReader); err != nil {
-			if err == io.EOF {
-				return result, stderrs, nil
-			}
-			return result, stderrs, err
-		} else {
-			result = append(result, res)
-		}
-		stderr, err := s.readPipe(errReader)
-		if stderr != "" {
-			stderrs = append(stderrs, stderr)
-		}
-		if err != nil {
-			if err == io.EOF {
-				continue
-			}
-			return result, stderrs, err
+	result.Duration = time.Now().Sub(startTime)
+	result.Stdout = stdout.lines()
+	result.Stderr = stderr.lines()
+	result.Output = output.lines()
+	var exitErr *gossh.ExitError
+	switch {
+	case err == nil:
+	case errors.As(err, &exitErr):
+		result.ExitCode = exitErr.ExitStatus()
+	default:
+		result.ExitCode = -1
+		if ctx.Err() != nil {
+			return result, fmt.Errorf("command %q is canceled after %s: %w", cmd, result.Duration, ctx.Err())
 		}
+		return result, err
+	}
+	if stderr.err != "" {
+		return result, &SudoError{Host: s.sshClient.RemoteAddr().String(), Reason: stderr.err}
 	}
+	return result, nil
 }
 
-// readPipe read pipe buffer
-func (s *ssh) readPipe(reader *bufio.Reader) (string, error) {
-	line, _, err := reader.ReadLine()
-	if err == io.EOF {
-		return "", err
-	}
-	if err != nil && err != io.EOF {
-		return "", errors.New(fmt.Sprintf(err.Error(), "Read pipe buffer failed"))
+// ExecTimeout executes the command with a timeout, timeout <= 0 means no timeout
+func (s *ssh) ExecTimeout(cmd string, timeout time.Duration) (*ExecResult, error) {
+	ctx := context.Background()
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
 	}
-	return string(line), nil
+	return s.Exec(ctx, cmd)
+}
+
+// SetSudo sets how the commands prefixed with sudo are run
+func (s *ssh) SetSudo(sudo Sudo) {
+	s.sudo = sudo
 }
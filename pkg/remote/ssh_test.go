@@ -0,0 +1,510 @@
+package remote
+
+import (
+	"bufio"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	gosftp "github.com/pkg/sftp"
+	gossh "golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// testServer 进程内的ssh服务端，接受指定的密码和公钥，exec请求原样输出命令。
+// exit N以退出码N结束，sleep一直等待到被kill，interleave交替输出到stdout和stderr，
+// sha256sum计算本地文件的校验值，sftp子系统直接读写本地文件
+type testServer struct {
+	host     string
+	port     string
+	password string
+	keys     []gossh.PublicKey
+	hostKey  gossh.PublicKey
+	// 模拟sudo时要求的密码
+	sudoPassword string
+}
+
+func newTestServer(t *testing.T, password string, keys ...gossh.PublicKey) *testServer {
+	t.Helper()
+	_, hostKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hostSigner, err := gossh.NewSignerFromKey(hostKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := &testServer{password: password, keys: keys, hostKey: hostSigner.PublicKey()}
+	config := &gossh.ServerConfig{
+		PasswordCallback: func(conn gossh.ConnMetadata, pass []byte) (*gossh.Permissions, error) {
+			if s.password != "" && string(pass) == s.password {
+				return nil, nil
+			}
+			return nil, gossh.ErrNoAuth
+		},
+		PublicKeyCallback: func(conn gossh.ConnMetadata, key gossh.PublicKey) (*gossh.Permissions, error) {
+			for _, k := range s.keys {
+				if string(k.Marshal()) == string(key.Marshal()) {
+					return nil, nil
+				}
+			}
+			return nil, gossh.ErrNoAuth
+		},
+	}
+	config.AddHostKey(hostSigner)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = listener.Close() })
+	s.host, s.port, _ = net.SplitHostPort(listener.Addr().String())
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn, config)
+		}
+	}()
+	return s
+}
+
+func (s *testServer) serve(conn net.Conn, config *gossh.ServerConfig) {
+	_, chans, reqs, err := gossh.NewServerConn(conn, config)
+	if err != nil {
+		_ = conn.Close()
+		return
+	}
+	go gossh.DiscardRequests(reqs)
+	for newChannel := range chans {
+		if newChannel.ChannelType() == "direct-tcpip" {
+			go forward(newChannel)
+			continue
+		}
+		if newChannel.ChannelType() != "session" {
+			_ = newChannel.Reject(gossh.UnknownChannelType, "unsupported channel")
+			continue
+		}
+		channel, requests, err := newChannel.Accept()
+		if err != nil {
+			continue
+		}
+		go func() {
+			defer channel.Close()
+			for req := range requests {
+				if req.Type == "subsystem" && string(req.Payload[4:]) == "sftp" {
+					_ = req.Reply(true, nil)
+					if server, err := gosftp.NewServer(channel); err == nil {
+						_ = server.Serve()
+					}
+					return
+				}
+				if req.Type != "exec" {
+					_ = req.Reply(false, nil)
+					continue
+				}
+				var payload struct{ Command string }
+				_ = gossh.Unmarshal(req.Payload, &payload)
+				_ = req.Reply(true, nil)
+				status := uint32(0)
+				switch {
+				case strings.Contains(payload.Command, "sudo -S") && !s.sudo(channel):
+					status = 1
+				case strings.HasPrefix(payload.Command, "exit "):
+					n, _ := strconv.Atoi(strings.TrimPrefix(payload.Command, "exit "))
+					status = uint32(n)
+					_, _ = channel.Stderr().Write([]byte(payload.Command + "\n"))
+				case payload.Command == "sleep":
+					for r := range requests {
+						if r.Type == "signal" {
+							status = 137
+							break
+						}
+					}
+				case strings.HasPrefix(payload.Command, "sha256sum "):
+					file := strings.Split(payload.Command, "'")[1]
+					b, err := os.ReadFile(file)
+					if err != nil {
+						status = 1
+						break
+					}
+					_, _ = channel.Write([]byte(fmt.Sprintf("%x  %s\n", sha256.Sum256(b), file)))
+				case payload.Command == "interleave":
+					for i, w := range []io.Writer{channel, channel.Stderr(), channel} {
+						_, _ = w.Write([]byte(strconv.Itoa(i) + "\n"))
+						time.Sleep(20 * time.Millisecond)
+					}
+				default:
+					_, _ = channel.Write([]byte(payload.Command + "\n"))
+				}
+				_, _ = channel.SendRequest("exit-status", false, gossh.Marshal(struct{ Status uint32 }{status}))
+				return
+			}
+		}()
+	}
+}
+
+// sudo 模拟sudo -S：输出提示并从stdin读取密码，密码错误时最多重试3次
+func (s *testServer) sudo(channel gossh.Channel) bool {
+	reader := bufio.NewReader(channel)
+	for i := 0; i < 3; i++ {
+		_, _ = channel.Stderr().Write([]byte(sudoPrompt))
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			_, _ = channel.Stderr().Write([]byte("sudo: no password was provided\n"))
+			return false
+		}
+		if strings.TrimSuffix(line, "\n") == s.sudoPassword {
+			return true
+		}
+		_, _ = channel.Stderr().Write([]byte(sudoRetry + "\n"))
+	}
+	return false
+}
+
+// forward 作为跳板机转发客户端到目标主机的tcp连接
+func forward(newChannel gossh.NewChannel) {
+	var target struct {
+		Host     string
+		Port     uint32
+		OrigHost string
+		OrigPort uint32
+	}
+	if err := gossh.Unmarshal(newChannel.ExtraData(), &target); err != nil {
+		_ = newChannel.Reject(gossh.ConnectionFailed, err.Error())
+		return
+	}
+	conn, err := net.Dial("tcp", net.JoinHostPort(target.Host, strconv.Itoa(int(target.Port))))
+	if err != nil {
+		_ = newChannel.Reject(gossh.ConnectionFailed, err.Error())
+		return
+	}
+	channel, requests, err := newChannel.Accept()
+	if err != nil {
+		_ = conn.Close()
+		return
+	}
+	go gossh.DiscardRequests(requests)
+	go func() {
+		_, _ = io.Copy(channel, conn)
+		_ = channel.CloseWrite()
+	}()
+	_, _ = io.Copy(conn, channel)
+	_ = conn.Close()
+}
+
+// newTestKey 生成客户端密钥，passphrase不为空时加密保存
+func newTestKey(t *testing.T, passphrase string) (string, gossh.Signer) {
+	t.Helper()
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var block *pem.Block
+	if passphrase != "" {
+		block, err = gossh.MarshalPrivateKeyWithPassphrase(key, "test", []byte(passphrase))
+	} else {
+		block, err = gossh.MarshalPrivateKey(key, "test")
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	file := path.Join(t.TempDir(), "id_ed25519")
+	if err = os.WriteFile(file, pem.EncodeToMemory(block), 0600); err != nil {
+		t.Fatal(err)
+	}
+	signer, err := gossh.NewSignerFromKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return file, signer
+}
+
+// startAgent 启动进程内的ssh-agent并设置SSH_AUTH_SOCK
+func startAgent(t *testing.T, key interface{}) {
+	t.Helper()
+	keyring := agent.NewKeyring()
+	if err := keyring.Add(agent.AddedKey{PrivateKey: key}); err != nil {
+		t.Fatal(err)
+	}
+	socket := path.Join(t.TempDir(), "agent.sock")
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() { _ = agent.ServeAgent(keyring, conn) }()
+		}
+	}()
+	t.Setenv("SSH_AUTH_SOCK", socket)
+}
+
+// TestNewSSHClientAuth 验证密码、私钥、加密私钥和ssh-agent认证
+func TestNewSSHClientAuth(t *testing.T) {
+	keyFile, signer := newTestKey(t, "")
+	encryptedFile, encryptedSigner := newTestKey(t, "secret")
+	_, agentKey, _ := ed25519.GenerateKey(rand.Reader)
+	agentSigner, _ := gossh.NewSignerFromKey(agentKey)
+	startAgent(t, agentKey)
+
+	server := newTestServer(t, "pass", signer.PublicKey(), encryptedSigner.PublicKey(), agentSigner.PublicKey())
+	tests := []struct {
+		name     string
+		password string
+		key      SSHKey
+		ok       bool
+	}{
+		{"password", "pass", SSHKey{}, true},
+		{"wrong password", "wrong", SSHKey{}, false},
+		{"private key", "", SSHKey{PrivateKeyFile: keyFile}, true},
+		{"encrypted private key", "", SSHKey{PrivateKeyFile: encryptedFile, Passphrase: "secret"}, true},
+		{"missing passphrase", "", SSHKey{PrivateKeyFile: encryptedFile}, false},
+		{"agent", "", SSHKey{Agent: true}, true},
+		{"key falls back to password", "pass", SSHKey{PrivateKeyFile: func() string { f, _ := newTestKey(t, ""); return f }()}, true},
+		{"no credential", "", SSHKey{}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, err := NewSSHClient("root", tt.password, server.host, server.port, tt.key, gossh.FingerprintSHA256(server.hostKey))
+			if !tt.ok {
+				if err == nil {
+					t.Fatal("expected authentication to fail")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer client.sshClient.Close()
+			result, err := client.Exec(context.Background(), "hostname")
+			if err != nil || len(result.Stdout) != 1 || result.Stdout[0] != "hostname" {
+				t.Errorf("Exec = %+v, %v", result, err)
+			}
+		})
+	}
+}
+
+// TestHostKeyVerification 验证known_hosts校验、首次信任、固定指纹和公钥不匹配
+func TestHostKeyVerification(t *testing.T) {
+	server := newTestServer(t, "pass")
+	other := newTestServer(t, "pass")
+	dir := t.TempDir()
+	managed := path.Join(dir, "known_hosts")
+	defer func(c HostKeyConfig) { HostKeys = c }(HostKeys)
+
+	connect := func(fingerprint string) error {
+		client, err := NewSSHClient("root", "pass", server.host, server.port, SSHKey{}, fingerprint)
+		if err == nil {
+			_ = client.sshClient.Close()
+		}
+		return err
+	}
+	isHostKeyError := func(err error) bool {
+		var hostKeyErr *HostKeyError
+		return errors.As(err, &hostKeyErr)
+	}
+
+	// 未知主机在strict模式下被拒绝
+	HostKeys = HostKeyConfig{Policy: HostKeyStrict, ManagedFile: managed}
+	if err := connect(""); !isHostKeyError(err) {
+		t.Fatalf("strict: expected HostKeyError for an unknown host, got %v", err)
+	}
+
+	// tofu模式记录新主机后，strict模式可以连接
+	HostKeys.Policy = HostKeyTOFU
+	if err := connect(""); err != nil {
+		t.Fatalf("tofu: %v", err)
+	}
+	HostKeys.Policy = HostKeyStrict
+	if err := connect(""); err != nil {
+		t.Fatalf("strict after tofu: %v", err)
+	}
+
+	// known_hosts中记录的公钥与主机不一致时，tofu模式也拒绝连接
+	mismatch := path.Join(dir, "mismatch")
+	line := knownhosts.Line([]string{knownhosts.Normalize(net.JoinHostPort(server.host, server.port))}, other.hostKey)
+	if err := os.WriteFile(mismatch, []byte(line+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	HostKeys = HostKeyConfig{Policy: HostKeyTOFU, KnownHostsFiles: []string{mismatch}, ManagedFile: path.Join(dir, "empty")}
+	if err := connect(""); !isHostKeyError(err) {
+		t.Fatalf("expected HostKeyError for a mismatched key, got %v", err)
+	}
+
+	// 固定指纹优先于known_hosts
+	if err := connect(gossh.FingerprintSHA256(server.hostKey)); err != nil {
+		t.Fatalf("pinned fingerprint: %v", err)
+	}
+	if err := connect(gossh.FingerprintSHA256(other.hostKey)); !isHostKeyError(err) {
+		t.Fatalf("expected HostKeyError for a wrong pinned fingerprint, got %v", err)
+	}
+}
+
+// TestNewSSHClientThrough 验证通过跳板机连接节点，跳板机和节点分别认证
+func TestNewSSHClientThrough(t *testing.T) {
+	bastion := newTestServer(t, "bastion-pass")
+	node := newTestServer(t, "node-pass")
+	defer func(c HostKeyConfig) { HostKeys = c }(HostKeys)
+	HostKeys = HostKeyConfig{Policy: HostKeyInsecure}
+
+	jump, err := NewSSHClient("jump", "bastion-pass", bastion.host, bastion.port, SSHKey{}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = NewSSHClientThrough(jump, "root", "bastion-pass", node.host, node.port, SSHKey{}, ""); err == nil {
+		t.Fatal("expected the node to reject the credential of the jump host")
+	}
+	client, err := NewSSHClientThrough(jump, "root", "node-pass", node.host, node.port, SSHKey{}, gossh.FingerprintSHA256(node.hostKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := client.Exec(context.Background(), "uname -m")
+	if err != nil || len(result.Stdout) != 1 || result.Stdout[0] != "uname -m" {
+		t.Errorf("Exec = %+v, %v", result, err)
+	}
+	if err = client.Close(); err != nil {
+		t.Error(err)
+	}
+	// 关闭节点连接时一并关闭跳板机连接
+	if _, err = jump.Exec(context.Background(), "hostname"); err == nil {
+		t.Error("jump host is still open after the client is closed")
+	}
+}
+
+// TestSudoCommand 验证命令中的sudo被改写为从stdin读取密码
+func TestSudoCommand(t *testing.T) {
+	prompt := "sudo -S -p '" + sudoPrompt + "' "
+	tests := []struct {
+		cmd   string
+		login string
+		sudo  Sudo
+		want  string
+	}{
+		{"sudo mkdir -p /tmp/precheck", "ops", Sudo{}, prompt + "mkdir -p /tmp/precheck"},
+		{"cd /tmp/precheck && sudo ./transform kubelet rollback; echo $?", "ops", Sudo{}, "cd /tmp/precheck && " + prompt + "./transform kubelet rollback; echo $?"},
+		{"sudo kill -9 `cat pid`", "ops", Sudo{Become: "kube"}, prompt + "-u kube kill -9 `cat pid`"},
+		// 配置文件中的用户名经过转义，不能注入命令
+		{"sudo ls", "ops", Sudo{Become: "kube; touch /tmp/pwned"}, prompt + "-u 'kube; touch /tmp/pwned' ls"},
+		{"sudo ls", "ops", Sudo{Become: "$1`id`"}, prompt + "-u '$1`id`' ls"},
+		{"sudo rm -rf /tmp/precheck", "root", Sudo{}, "rm -rf /tmp/precheck"},
+		{"ls /tmp/pseudo", "ops", Sudo{}, "ls /tmp/pseudo"},
+	}
+	for _, tt := range tests {
+		if got := sudoCommand(tt.cmd, tt.login, tt.sudo); got != tt.want {
+			t.Errorf("sudoCommand(%q) = %q, want %q", tt.cmd, got, tt.want)
+		}
+	}
+}
+
+// TestExecSudo 验证sudo提示时输入密码，没有密码或密码错误时返回SudoError
+func TestExecSudo(t *testing.T) {
+	server := newTestServer(t, "login-pass")
+	server.sudoPassword = "sudo-pass"
+	defer func(c HostKeyConfig) { HostKeys = c }(HostKeys)
+	HostKeys = HostKeyConfig{Policy: HostKeyInsecure}
+
+	tests := []struct {
+		name   string
+		sudo   Sudo
+		reason string
+	}{
+		{"sudo password", Sudo{Password: "sudo-pass"}, ""},
+		{"login password is wrong", Sudo{}, "incorrect sudo password"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, err := NewSSHClient("ops", "login-pass", server.host, server.port, SSHKey{}, "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer client.Close()
+			client.SetSudo(tt.sudo)
+			result, err := client.Exec(context.Background(), "sudo true")
+			if tt.reason == "" {
+				if err != nil || !result.Success() || len(result.Stdout) != 1 || len(result.Stderr) != 0 {
+					t.Errorf("Exec = %+v, %v", result, err)
+				}
+				return
+			}
+			var sudoErr *SudoError
+			if !errors.As(err, &sudoErr) || sudoErr.Reason != tt.reason {
+				t.Errorf("expected SudoError %q, got %v", tt.reason, err)
+			}
+		})
+	}
+
+	// 使用密钥登录且没有配置密码时，提示需要sudo密码
+	keyFile, signer := newTestKey(t, "")
+	server.keys = append(server.keys, signer.PublicKey())
+	client, err := NewSSHClient("ops", "", server.host, server.port, SSHKey{PrivateKeyFile: keyFile}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	var sudoErr *SudoError
+	if _, err = client.Exec(context.Background(), "sudo true"); !errors.As(err, &sudoErr) || !strings.HasPrefix(sudoErr.Reason, "sudo requires password") {
+		t.Errorf("expected sudo requires password, got %v", err)
+	}
+}
+
+// TestExecResult 验证返回退出码和按顺序合并的输出，超时后结束远程命令
+func TestExecResult(t *testing.T) {
+	server := newTestServer(t, "login-pass")
+	defer func(c HostKeyConfig) { HostKeys = c }(HostKeys)
+	HostKeys = HostKeyConfig{Policy: HostKeyInsecure}
+	client, err := NewSSHClient("root", "login-pass", server.host, server.port, SSHKey{}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	result, err := client.Exec(context.Background(), "exit 3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Success() || result.ExitCode != 3 || result.Message() != "exit 3" {
+		t.Errorf("Exec(exit 3) = %+v", result)
+	}
+
+	result, err = client.Exec(context.Background(), "interleave")
+	if err != nil || !result.Success() {
+		t.Fatalf("Exec(interleave) = %+v, %v", result, err)
+	}
+	if got := strings.Join(result.Output, ","); got != "0,1,2" {
+		t.Errorf("Output = %s, want 0,1,2", got)
+	}
+	if got := strings.Join(result.Stdout, ","); got != "0,2" {
+		t.Errorf("Stdout = %s, want 0,2", got)
+	}
+
+	result, err = client.ExecTimeout("sleep", 100*time.Millisecond)
+	if !errors.Is(err, context.DeadlineExceeded) || result.Success() {
+		t.Errorf("expected deadline exceeded, got %+v, %v", result, err)
+	}
+	if result.Duration > 5*time.Second {
+		t.Errorf("command is not killed after the timeout, took %s", result.Duration)
+	}
+}
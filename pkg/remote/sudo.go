@@ -0,0 +1,150 @@
+package remote
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// sudoPrompt is passed to sudo -p so that the password prompt can be told apart from the output
+const sudoPrompt = "[transform-sudo-prompt]"
+
+// sudo prints this when the password is wrong and asks again
+const sudoRetry = "Sorry, try again."
+
+// sudo at the beginning of the command or after a shell operator
+var sudoPattern = regexp.MustCompile(`(^|[;&|(]\s*)sudo\s+`)
+
+// Sudo how the commands prefixed with sudo are run on the remote host
+type Sudo struct {
+	// password for sudo, the login password is used when empty
+	Password string
+	// user to become, root by default. When the login user is the same, sudo is not used at all
+	Become string
+}
+
+// SudoError sudo can not be used on the remote host
+type SudoError struct {
+	Host   string
+	Reason string
+}
+
+func (e *SudoError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Host, e.Reason)
+}
+
+// sudoCommand rewrites every sudo in the command to read the password from stdin with a known prompt
+func sudoCommand(cmd, login string, sudo Sudo) string {
+	become := sudo.Become
+	if become == "" {
+		become = "root"
+	}
+	if login == become {
+		return sudoPattern.ReplaceAllString(cmd, "$1")
+	}
+	flags := fmt.Sprintf("sudo -S -p '%s' ", sudoPrompt)
+	if become != "root" {
+		flags += fmt.Sprintf("-u %s ", Quote(become))
+	}
+	// $ in the flags is literal, not a reference to a submatch
+	return sudoPattern.ReplaceAllString(cmd, "${1}"+strings.ReplaceAll(flags, "$", "$$"))
+}
+
+// promptWriter collects stderr and answers every sudo prompt with the password.
+// It stops answering after a wrong password to avoid locking the account
+type promptWriter struct {
+	stream
+	stdin    io.Writer
+	password string
+	// number of prompts answered
+	prompts int
+	err     string
+}
+
+func (w *promptWriter) Write(p []byte) (int, error) {
+	// 提示符不写入合并的输出
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.buf.Write(p)
+	w.output.write(bytes.ReplaceAll(p, []byte(sudoPrompt), nil))
+	if w.err != "" {
+		return len(p), nil
+	}
+	if strings.Contains(w.buf.String(), sudoRetry) {
+		w.err = "incorrect sudo password"
+		if c, ok := w.stdin.(io.Closer); ok {
+			_ = c.Close()
+		}
+		return len(p), nil
+	}
+	for n := strings.Count(w.buf.String(), sudoPrompt); w.prompts < n; w.prompts++ {
+		if w.password == "" {
+			w.err = "sudo requires password, set sudoPassword or password of the host"
+			if c, ok := w.stdin.(io.Closer); ok {
+				_ = c.Close()
+			}
+			return len(p), nil
+		}
+		_, _ = io.WriteString(w.stdin, w.password+"\n")
+	}
+	return len(p), nil
+}
+
+// lines stderr without the sudo prompts
+func (w *promptWriter) lines() []string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return splitLines(strings.ReplaceAll(w.buf.String(), sudoPrompt, ""))
+}
+
+// stream collects one of stdout and stderr, and copies it to the interleaved output
+type stream struct {
+	mu     sync.Mutex
+	buf    bytes.Buffer
+	output *output
+}
+
+func (s *stream) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.buf.Write(p)
+	s.output.write(p)
+	return len(p), nil
+}
+
+func (s *stream) lines() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return splitLines(s.buf.String())
+}
+
+// output stdout and stderr in the order they were received
+type output struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (o *output) write(p []byte) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.buf.Write(p)
+}
+
+func (o *output) lines() []string {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return splitLines(o.buf.String())
+}
+
+func splitLines(s string) []string {
+	lines := []string{}
+	for _, line := range strings.Split(strings.TrimRight(s, "\n"), "\n") {
+		if line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
@@ -0,0 +1,58 @@
+package remote
+
+import (
+	"fmt"
+	"path"
+	"strings"
+	"time"
+)
+
+// partSuffix 上传中的文件的后缀，校验通过后才重命名为目标文件
+const partSuffix = ".part"
+
+// checksumTimeout 远程计算sha256的超时时间
+const checksumTimeout = 5 * time.Minute
+
+// ProgressFunc 上传文件的进度，written为已经写入远程的字节数
+type ProgressFunc func(host, file string, written, total int64)
+
+// UploadFile 上传文件到远程目录。文件先写入.part临时文件，中断后再次上传时从已写入的位置继续，
+// 远程计算的sha256与本地一致后才重命名为目标文件。返回文件的大小和sha256
+func (c *Cli) UploadFile(src, dstDir string, progress func(written, total int64)) (int64, string, error) {
+	dst := path.Join(dstDir, path.Base(src))
+	part := dst + partSuffix
+	size, sum, err := c.SFTP.UploadFile(src, part, progress)
+	if err != nil {
+		return size, "", err
+	}
+	remoteSum, err := c.checksum(part)
+	if err != nil {
+		return size, "", err
+	}
+	if remoteSum != sum {
+		// 已上传的部分与本地文件不一致，删除后重新上传
+		_ = c.SFTP.Remove(part)
+		return size, "", fmt.Errorf("sha256 of %s does not match, local %s, remote %s", dst, sum, remoteSum)
+	}
+	if err = c.SFTP.Rename(part, dst); err != nil {
+		return size, "", fmt.Errorf("failed to rename %s to %s: %v", part, dst, err)
+	}
+	return size, sum, nil
+}
+
+// checksum 在远程主机上计算文件的sha256，没有sha256sum时使用openssl
+func (c *Cli) checksum(file string) (string, error) {
+	cmd := fmt.Sprintf("sha256sum '%s' 2>/dev/null || openssl dgst -sha256 -r '%s'", file, file)
+	result, err := c.SSH.ExecTimeout(cmd, checksumTimeout)
+	if err != nil {
+		return "", err
+	}
+	if !result.Success() || len(result.Stdout) == 0 {
+		return "", fmt.Errorf("failed to compute sha256 of %s: %s", file, result.Message())
+	}
+	fields := strings.Fields(result.Stdout[0])
+	if len(fields) == 0 {
+		return "", fmt.Errorf("failed to compute sha256 of %s: empty output", file)
+	}
+	return strings.ToLower(fields[0]), nil
+}
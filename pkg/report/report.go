@@ -36,6 +36,7 @@ type ReportData struct {
 	Result       string       `yaml:"result" json:"result"`
 	Case         []CaseInfo   `yaml:"case" json:"case"`
 	Server       []ServerInfo `yaml:"server" json:"server"`
+	Plan         []PlanInfo   `yaml:"plan,omitempty" json:"plan,omitempty"`
 }
 
 type CaseInfo struct {
@@ -48,6 +49,22 @@ type CaseInfo struct {
 	DurationTime string `yaml:"durationTime" json:"durationTime"`
 }
 
+// PlanInfo 节点的转换计划
+type PlanInfo struct {
+	IP               string   `yaml:"ip" json:"ip"`
+	Runtime          string   `yaml:"runtime" json:"runtime"`
+	DetectedRuntimes []string `yaml:"detectedRuntimes" json:"detectedRuntimes"`
+	Image            string   `yaml:"image" json:"image"`
+	Version          string   `yaml:"version" json:"version"`
+	DownloadURL      string   `yaml:"downloadURL" json:"downloadURL"`
+	DownloadStatus   string   `yaml:"downloadStatus" json:"downloadStatus"`
+	UnitFile         string   `yaml:"unitFile" json:"unitFile"`
+	Unit             string   `yaml:"unit" json:"unit"`
+	Diff             string   `yaml:"diff" json:"diff"`
+	Steps            []string `yaml:"steps" json:"steps"`
+	Warnings         []string `yaml:"warnings" json:"warnings"`
+}
+
 type ServerInfo struct {
 	IP        string   `yaml:"ip" json:"ip"`
 	RoleDef   []string `yaml:"roleDef" json:"roleDef"`
@@ -93,6 +110,7 @@ func GenerateReport(startTime time.Time, dataList []ReportData) error {
 		rd.Warning += data.Warning
 		rd.Case = append(rd.Case, data.Case...)
 		rd.Server = append(rd.Server, data.Server...)
+		rd.Plan = append(rd.Plan, data.Plan...)
 	}
 
 
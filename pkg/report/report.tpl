@@ -125,6 +125,48 @@
         {{end}}
 	</table>
 	
+	{{if .Plan}}
+	<h2>计划变更</h2>
+	{{range .Plan}}
+	<h3>{{.IP}}</h3>
+	<table>
+		<tr>
+			<th>运行时</th>
+			<th>检测到的运行时</th>
+			<th>镜像</th>
+			<th>kubelet版本</th>
+			<th>kubelet下载地址</th>
+			<th>下载状态</th>
+		</tr>
+		<tr>
+			<td>{{.Runtime}}</td>
+			<td>{{range .DetectedRuntimes}}{{.}} {{end}}</td>
+			<td>{{.Image}}</td>
+			<td>{{.Version}}</td>
+			<td>{{.DownloadURL}}</td>
+			<td>{{.DownloadStatus}}</td>
+		</tr>
+	</table>
+	{{if .Warnings}}
+	<ul>
+		{{range .Warnings}}<li style="color:orange">{{html .}}</li>{{end}}
+	</ul>
+	{{end}}
+	<ol>
+		{{range .Steps}}<li>{{html .}}</li>{{end}}
+	</ol>
+	{{if .Diff}}
+	<pre>{{html .Diff}}</pre>
+	{{else}}
+	<div>{{.UnitFile}} 无变化</div>
+	{{end}}
+	<details>
+		<summary>{{.UnitFile}}</summary>
+		<pre>{{html .Unit}}</pre>
+	</details>
+	{{end}}
+	{{end}}
+
 	<h2>服务器信息</h2>
 	<table>
 		<tr>
@@ -42,6 +42,15 @@ func TestReport(t *testing.T) {
 			{OS: "Ubuntu 20.04", CPU: "Intel Core i7", Memory: "16 GB", Network: "eth0", Disk: "512 GB SSD"},
 			{OS: "CentOS 7", CPU: "AMD Ryzen 5", Memory: "8 GB", Network: "eth0", Disk: "256 GB SSD"},
 		},
+		Plan: []PlanInfo{
+			{
+				IP:       "192.168.1.10",
+				Runtime:  "docker",
+				Unit:     "ExecStart=/usr/bin/kubelet --eviction-hard=memory.available<100Mi",
+				Diff:     "-ExecStart=/usr/bin/kubelet\n+ExecStart=/usr/bin/kubelet --eviction-hard=memory.available<100Mi\n",
+				Warnings: []string{"tmpfs mount at /run has no host equivalent"},
+			},
+		},
 	}
 	err := Report(data)
 	if err != nil {
@@ -0,0 +1,206 @@
+package serve
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"transform/pkg/root"
+	"transform/utils/log"
+)
+
+// SumsFile 校验文件的名称，格式与sha256sum的输出一致，可以直接用sha256sum -c校验
+const SumsFile = "SHA256SUMS"
+
+type Options struct {
+	root.Options
+	// 提供下载的目录，例如kubelet-<version>-<arch>和transform二进制文件
+	Dir  string `json:"dir"`
+	Port int    `json:"port"`
+}
+
+// artifact 目录中的一个文件
+type artifact struct {
+	Name    string
+	Size    int64
+	ModTime time.Time
+	SHA256  string
+}
+
+// server 提供目录中的文件、文件索引和SHA256SUMS
+type server struct {
+	dir   string
+	files http.Handler
+	mu    sync.Mutex
+	// 按文件名缓存校验值，文件大小或修改时间变化时重新计算
+	sums map[string]artifact
+}
+
+// Run 启动http服务提供目录中的文件下载，直到进程退出
+func (op *Options) Run() error {
+	handler, err := op.Handler()
+	if err != nil {
+		return err
+	}
+	address := net.JoinHostPort("", strconv.Itoa(op.Port))
+	log.Info(fmt.Sprintf("提供%s目录下的文件下载，监听%s", op.Dir, address))
+	return http.ListenAndServe(address, handler)
+}
+
+// Start 在后台启动http服务，由调用方关闭
+func (op *Options) Start() (*http.Server, error) {
+	handler, err := op.Handler()
+	if err != nil {
+		return nil, err
+	}
+	l, err := net.Listen("tcp", net.JoinHostPort("", strconv.Itoa(op.Port)))
+	if err != nil {
+		return nil, err
+	}
+	s := &http.Server{Handler: handler}
+	go func() {
+		if err := s.Serve(l); err != nil && err != http.ErrServerClosed {
+			log.Info(fmt.Sprintf("文件下载服务异常退出: %s", err.Error()))
+		}
+	}()
+	log.Info(fmt.Sprintf("提供%s目录下的文件下载，监听%s", op.Dir, l.Addr().String()))
+	return s, nil
+}
+
+// Handler 返回提供目录中文件下载的http handler。/返回文件索引，/SHA256SUMS返回各文件的校验值，
+// 其余路径返回文件内容，支持Range请求断点续传
+func (op *Options) Handler() (http.Handler, error) {
+	fi, err := os.Stat(op.Dir)
+	if err != nil {
+		return nil, err
+	}
+	if !fi.IsDir() {
+		return nil, errors.New(fmt.Sprintf("%s is not a directory", op.Dir))
+	}
+	s := &server{
+		dir:   op.Dir,
+		files: http.FileServer(http.Dir(op.Dir)),
+		sums:  map[string]artifact{},
+	}
+	return s, nil
+}
+
+func (s *server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case "/", "/index.html":
+		s.index(w, r)
+	case "/" + SumsFile:
+		// 目录中已有的SHA256SUMS优先，例如带签名的发布文件
+		if _, err := os.Stat(path.Join(s.dir, SumsFile)); err == nil {
+			s.files.ServeHTTP(w, r)
+			return
+		}
+		s.sumsFile(w)
+	default:
+		s.files.ServeHTTP(w, r)
+	}
+}
+
+var indexTpl = template.Must(template.New("index").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>transform artifacts</title></head>
+<body>
+<h1>transform artifacts</h1>
+<table>
+<tr><th>name</th><th>size</th><th>modified</th><th>sha256</th></tr>
+{{- range .}}
+<tr><td><a href="{{.Name}}">{{.Name}}</a></td><td>{{.Size}}</td><td>{{.ModTime.Format "2006-01-02 15:04:05"}}</td><td>{{.SHA256}}</td></tr>
+{{- end}}
+</table>
+<p><a href="SHA256SUMS">SHA256SUMS</a></p>
+</body>
+</html>
+`))
+
+func (s *server) index(w http.ResponseWriter, r *http.Request) {
+	artifacts, err := s.artifacts()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	_ = indexTpl.Execute(w, artifacts)
+}
+
+func (s *server) sumsFile(w http.ResponseWriter) {
+	artifacts, err := s.artifacts()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	_, _ = io.WriteString(w, sums(artifacts))
+}
+
+// sums 按sha256sum的格式输出文件的校验值
+func sums(artifacts []artifact) string {
+	var b strings.Builder
+	for _, a := range artifacts {
+		b.WriteString(fmt.Sprintf("%s  %s\n", a.SHA256, a.Name))
+	}
+	return b.String()
+}
+
+// artifacts 目录中的普通文件，按名称排序
+func (s *server) artifacts() ([]artifact, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	artifacts := []artifact{}
+	for _, e := range entries {
+		if !e.Type().IsRegular() || e.Name() == SumsFile || strings.HasPrefix(e.Name(), ".") {
+			continue
+		}
+		fi, err := e.Info()
+		if err != nil {
+			return nil, err
+		}
+		a, ok := s.sums[e.Name()]
+		if !ok || a.Size != fi.Size() || !a.ModTime.Equal(fi.ModTime()) {
+			sum, err := fileSHA256(path.Join(s.dir, e.Name()))
+			if err != nil {
+				return nil, err
+			}
+			a = artifact{Name: e.Name(), Size: fi.Size(), ModTime: fi.ModTime(), SHA256: sum}
+			s.sums[e.Name()] = a
+		}
+		artifacts = append(artifacts, a)
+	}
+	sort.Slice(artifacts, func(i, j int) bool {
+		return artifacts[i].Name < artifacts[j].Name
+	})
+	return artifacts, nil
+}
+
+func fileSHA256(file string) (string, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err = io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,79 @@
+package serve
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"strings"
+	"testing"
+)
+
+// TestHandler 验证文件下载、Range请求、索引和SHA256SUMS
+func TestHandler(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"kubelet-1.21.13-amd64": "kubelet binary",
+		"transform-amd64":       "transform binary",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(path.Join(dir, name), []byte(content), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	op := &Options{Dir: dir}
+	handler, err := op.Handler()
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	get := func(p string, header map[string]string) (int, string) {
+		req, _ := http.NewRequest(http.MethodGet, server.URL+p, nil)
+		for k, v := range header {
+			req.Header.Set(k, v)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		b, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, string(b)
+	}
+
+	if code, body := get("/kubelet-1.21.13-amd64", nil); code != http.StatusOK || body != "kubelet binary" {
+		t.Errorf("GET kubelet = %d %q", code, body)
+	}
+	if code, body := get("/kubelet-1.21.13-amd64", map[string]string{"Range": "bytes=8-"}); code != http.StatusPartialContent || body != "binary" {
+		t.Errorf("GET kubelet with range = %d %q", code, body)
+	}
+
+	want := ""
+	for _, name := range []string{"kubelet-1.21.13-amd64", "transform-amd64"} {
+		want += fmt.Sprintf("%x  %s\n", sha256.Sum256([]byte(files[name])), name)
+	}
+	if code, body := get("/"+SumsFile, nil); code != http.StatusOK || body != want {
+		t.Errorf("GET SHA256SUMS = %d %q, want %q", code, body, want)
+	}
+	if _, body := get("/", nil); !strings.Contains(body, `<a href="transform-amd64">`) || !strings.Contains(body, fmt.Sprintf("%x", sha256.Sum256([]byte(files["transform-amd64"])))) {
+		t.Errorf("index does not list the files:\n%s", body)
+	}
+
+	// 目录中已有的SHA256SUMS优先
+	if err = os.WriteFile(path.Join(dir, SumsFile), []byte("signed sums\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, body := get("/"+SumsFile, nil); body != "signed sums\n" {
+		t.Errorf("GET SHA256SUMS = %q, want the file in the directory", body)
+	}
+
+	op.Dir = path.Join(dir, "transform-amd64")
+	if _, err = op.Handler(); err == nil {
+		t.Error("expected error for a file")
+	}
+}
@@ -0,0 +1,57 @@
+package utils
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+)
+
+// FindInTar 在tar流中查找文件，返回文件的头信息，之后从返回的Reader读取文件内容。
+// name与tar中的路径比较时忽略开头的/和./
+func FindInTar(r io.Reader, name string) (*tar.Header, io.Reader, error) {
+	name = cleanTarPath(name)
+	tr := tar.NewReader(r)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil, nil, errors.New(fmt.Sprintf("%s not found in archive", name))
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		if cleanTarPath(header.Name) == name {
+			return header, tr, nil
+		}
+	}
+}
+
+// ExtractFromTarball 从tar.gz文件中取出一个普通文件，写入destinationFile
+func ExtractFromTarball(tarball, name, destinationFile, sum string) error {
+	f, err := os.Open(tarball)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return err
+	}
+	defer gz.Close()
+	header, r, err := FindInTar(gz, name)
+	if err != nil {
+		return err
+	}
+	if header.Typeflag != tar.TypeReg {
+		return errors.New(fmt.Sprintf("%s in %s is not a regular file", name, tarball))
+	}
+	return SaveFile(r, destinationFile, sum)
+}
+
+func cleanTarPath(name string) string {
+	return strings.TrimPrefix(path.Clean("/"+name), "/")
+}
@@ -5,6 +5,8 @@ const (
 	NerdCtl                  = "/usr/bin/nerdctl"
 
 	KUBELET_NAME 		 = "kubelet"
-)
 
+	KubeletServiceFile = "/etc/systemd/system/kubelet.service"
+	KubeletBinary      = "/usr/bin/kubelet"
+)
 
@@ -0,0 +1,54 @@
+package utils
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Diff 按行比较两段文本，输出类似diff -u的结果，内容相同时返回空字符串
+func Diff(oldName, newName, oldText, newText string) string {
+	if oldText == newText {
+		return ""
+	}
+	a := strings.Split(strings.TrimSuffix(oldText, "\n"), "\n")
+	b := strings.Split(strings.TrimSuffix(newText, "\n"), "\n")
+	if oldText == "" {
+		a = []string{}
+	}
+
+	// lcs[i][j] 表示a[i:]与b[j:]的最长公共子序列长度
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	out := strings.Builder{}
+	out.WriteString(fmt.Sprintf("--- %s\n+++ %s\n", oldName, newName))
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			out.WriteString(" " + a[i] + "\n")
+			i++
+			j++
+		case i < len(a) && (j == len(b) || lcs[i+1][j] >= lcs[i][j+1]):
+			out.WriteString("-" + a[i] + "\n")
+			i++
+		default:
+			out.WriteString("+" + b[j] + "\n")
+			j++
+		}
+	}
+	return out.String()
+}
@@ -0,0 +1,25 @@
+package utils
+
+import "testing"
+
+func TestDiff(t *testing.T) {
+	old := "[Service]\nExecStart=/usr/bin/kubelet --v=2\nRestart=always\n"
+	planned := "[Service]\nEnvironment=A=b\nExecStart=/usr/bin/kubelet --v=4\nRestart=always\n"
+	want := `--- old
++++ new
+ [Service]
+-ExecStart=/usr/bin/kubelet --v=2
++Environment=A=b
++ExecStart=/usr/bin/kubelet --v=4
+ Restart=always
+`
+	if got := Diff("old", "new", old, planned); got != want {
+		t.Errorf("Diff() =\n%s\nwant\n%s", got, want)
+	}
+	if got := Diff("old", "new", old, old); got != "" {
+		t.Errorf("Diff() of equal text = %q", got)
+	}
+	if got := Diff("old", "new", "", "a\n"); got != "--- old\n+++ new\n+a\n" {
+		t.Errorf("Diff() of new file = %q", got)
+	}
+}
@@ -2,6 +2,8 @@ package utils
 
 import (
 	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"io"
@@ -56,24 +58,56 @@ func httpGet(url string) (string, error) {
 	return string(body), nil
 }
 
+// DownloadFile 下载文件，先写入同一目录下的临时文件，同步到磁盘后再重命名为目标文件
 func DownloadFile(url, destinationFile string) error {
+	return DownloadFileWithSHA256(url, destinationFile, "")
+}
+
+// DownloadFileWithSHA256 与DownloadFile相同，sum不为空时校验文件的sha256，校验失败时目标文件保持不变
+func DownloadFileWithSHA256(url, destinationFile, sum string) error {
 	resp, err := http.Get(url)
 	if err != nil {
 		return err
 	}
 	defer resp.Body.Close()
 	if resp.StatusCode != 200 {
-		return errors.New(fmt.Sprintf("File cannot be found %d", resp.StatusCode))
+		return errors.New(fmt.Sprintf("File cannot be found %s, status code %d", url, resp.StatusCode))
+	}
+	if err = SaveFile(resp.Body, destinationFile, sum); err != nil {
+		return errors.New(fmt.Sprintf("failed to save %s: %s", url, err.Error()))
 	}
-	reader := bufio.NewReaderSize(resp.Body, 32*1024)
-	file, err := os.Create(destinationFile)
+	return nil
+}
+
+// SaveFile 将r的内容写入同一目录下的临时文件，sum不为空时校验sha256，同步到磁盘后再重命名为目标文件
+func SaveFile(r io.Reader, destinationFile, sum string) error {
+	file, err := os.CreateTemp(path.Dir(destinationFile), "."+path.Base(destinationFile)+".*.tmp")
 	if err != nil {
 		return err
 	}
-	writer := bufio.NewWriter(file)
-	_, err = io.Copy(writer, reader)
-	if err != nil {
+	tmp := file.Name()
+	defer os.Remove(tmp)
+	defer file.Close()
+	if err = file.Chmod(0644); err != nil {
 		return err
 	}
-	return nil
+
+	hash := sha256.New()
+	writer := bufio.NewWriterSize(io.MultiWriter(file, hash), 32*1024)
+	if _, err = io.Copy(writer, r); err != nil {
+		return err
+	}
+	if err = writer.Flush(); err != nil {
+		return err
+	}
+	if err = file.Sync(); err != nil {
+		return err
+	}
+	if err = file.Close(); err != nil {
+		return err
+	}
+	if actual := hex.EncodeToString(hash.Sum(nil)); sum != "" && !strings.EqualFold(actual, sum) {
+		return errors.New(fmt.Sprintf("sha256 is %s, expected %s", actual, sum))
+	}
+	return os.Rename(tmp, destinationFile)
 }
@@ -0,0 +1,50 @@
+package utils
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"testing"
+)
+
+// TestDownloadFileWithSHA256 验证校验失败或下载失败时目标文件保持不变，也不留下临时文件
+func TestDownloadFileWithSHA256(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/kubelet" {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = w.Write([]byte("new kubelet"))
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	dst := path.Join(dir, "kubelet")
+	if err := os.WriteFile(dst, []byte("old kubelet"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	sum := fmt.Sprintf("%x", sha256.Sum256([]byte("new kubelet")))
+
+	if err := DownloadFileWithSHA256(server.URL+"/kubelet", dst, fmt.Sprintf("%x", sha256.Sum256([]byte("other")))); err == nil {
+		t.Error("expected checksum mismatch")
+	}
+	if err := DownloadFileWithSHA256(server.URL+"/missing", dst, sum); err == nil {
+		t.Error("expected error for 404")
+	}
+	if b, _ := os.ReadFile(dst); string(b) != "old kubelet" {
+		t.Errorf("destination is modified: %q", b)
+	}
+
+	if err := DownloadFileWithSHA256(server.URL+"/kubelet", dst, sum); err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := os.ReadFile(dst); string(b) != "new kubelet" {
+		t.Errorf("destination = %q", b)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+		t.Errorf("temporary files are left: %v", entries)
+	}
+}
@@ -132,14 +132,12 @@ func IsChanClosed(ch interface{}) bool {
 	if reflect.TypeOf(ch).Kind() != reflect.Chan {
 		panic("only channels!")
 	}
-	cptr := *(*uintptr)(unsafe.Pointer(
-		unsafe.Pointer(uintptr(unsafe.Pointer(&ch)) + unsafe.Sizeof(uint(0))),
-	))
-
-	cptr += unsafe.Sizeof(uint(0)) * 2
-	cptr += unsafe.Sizeof(unsafe.Pointer(uintptr(0)))
-	cptr += unsafe.Sizeof(uint16(0))
-	return *(*uint32)(unsafe.Pointer(cptr)) > 0
+	cptr := *(*unsafe.Pointer)(unsafe.Add(unsafe.Pointer(&ch), unsafe.Sizeof(uint(0))))
+
+	cptr = unsafe.Add(cptr, unsafe.Sizeof(uint(0))*2)
+	cptr = unsafe.Add(cptr, unsafe.Sizeof(cptr))
+	cptr = unsafe.Add(cptr, unsafe.Sizeof(uint16(0)))
+	return *(*uint32)(cptr) > 0
 }
 
 // ReverseArray reverse array